@@ -0,0 +1,107 @@
+// Command kmsrotate makes a new master key current in the key file and
+// rewraps every master-wrapped envelope (wallet keys and HD seeds) that is
+// still under an older key. Only the data keys are re-encrypted. Old keys stay
+// in the file, so a rewrap that is interrupted can simply be run again with
+// -rewrap-only.
+//
+// A running server needs no restart: it re-reads the key file when it meets
+// an envelope under a key it does not know, and on SIGHUP. Send SIGHUP after
+// rotating so that new envelopes are wrapped under the new key as well.
+//
+//	WALLET_KMS_FILE=kms.json WALLET_KMS_PASSPHRASE=... go run ./cmd/kmsrotate [-rewrap-only] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/joho/godotenv"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/db"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/kms"
+)
+
+// stored is one envelope column value.
+type stored struct {
+	table, keyCol, key, valueCol, value string
+}
+
+func main() {
+	rewrapOnly := flag.Bool("rewrap-only", false, "rewrap envelopes under the current key without rotating")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, relying on system environment")
+	}
+	km, err := kms.FromEnv()
+	if err != nil {
+		log.Fatalf("key manager: %v", err)
+	}
+	kms.Init(km)
+
+	ctx := context.Background()
+	if !*rewrapOnly && !*dryRun {
+		id, err := km.Rotate(ctx)
+		if err != nil {
+			log.Fatalf("rotate: %v", err)
+		}
+		log.Printf("master key %s is now current", id)
+	}
+	current := km.CurrentKeyID()
+
+	pool, err := db.ConnectDB()
+	if err != nil {
+		log.Fatalf("DB connection failed: %v", err)
+	}
+	defer pool.Close()
+
+	var values []stored
+	for _, q := range []stored{
+		{table: "wallets", keyCol: "wallet_id", valueCol: "private_key_enc"},
+		{table: "user_seeds", keyCol: "user_id::text", valueCol: "seed_enc"},
+	} {
+		rows, err := pool.Query(ctx,
+			`SELECT `+q.keyCol+`, `+q.valueCol+` FROM `+q.table+` WHERE `+q.valueCol+` LIKE '{%'`)
+		if err != nil {
+			log.Fatalf("query %s: %v", q.table, err)
+		}
+		for rows.Next() {
+			v := q
+			if err := rows.Scan(&v.key, &v.value); err != nil {
+				log.Fatalf("scan %s: %v", q.table, err)
+			}
+			if env, err := envelope.Parse(v.value); err == nil && env.Wrap == envelope.WrapMaster && env.MasterKey != current {
+				values = append(values, v)
+			}
+		}
+		rows.Close()
+	}
+
+	rewrapped, failed := 0, 0
+	for _, v := range values {
+		next, err := envelope.Rewrap(v.value, "", "")
+		if err != nil {
+			failed++
+			log.Printf("%s %s: %v", v.table, v.key, err)
+			continue
+		}
+		if !*dryRun {
+			// Only replace the exact value read, in case it changed meanwhile.
+			tag, err := pool.Exec(ctx,
+				`UPDATE `+v.table+` SET `+v.valueCol+`=$3 WHERE `+v.keyCol+`=$1 AND `+v.valueCol+`=$2`,
+				v.key, v.value, next)
+			if err != nil {
+				log.Fatalf("%s %s: %v", v.table, v.key, err)
+			}
+			if tag.RowsAffected() == 0 {
+				log.Printf("%s %s: changed during rewrap, skipped", v.table, v.key)
+				continue
+			}
+		}
+		rewrapped++
+	}
+	log.Printf("%d envelopes under older master keys: %d rewrapped, %d failed", len(values), rewrapped, failed)
+}
@@ -0,0 +1,101 @@
+// Command rekey migrates wallet keys written before envelope encryption.
+// Those values are AES-GCM ciphertexts under the owner's user ID copied into a
+// 32-byte key. Each one is decrypted, checked against the wallet's public key
+// and re-encrypted as an envelope wrapped by the key manager's current master
+// key (see internal/kms). Owners can then move their wallet to passphrase
+// wrapping with /wallet/passphrase.
+//
+//	WALLET_MASTER_KEY=<64 hex> go run ./cmd/rekey [-dry-run]
+//	WALLET_KMS_FILE=kms.json WALLET_KMS_PASSPHRASE=... go run ./cmd/rekey [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/joho/godotenv"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/db"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/kms"
+)
+
+type legacyWallet struct {
+	walletID, userID, publicKey, enc string
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, relying on system environment")
+	}
+	km, err := kms.FromEnv()
+	if err != nil {
+		log.Fatalf("key manager: %v", err)
+	}
+	if km.CurrentKeyID() == "" {
+		log.Fatal(envelope.ErrNoMasterKey)
+	}
+	kms.Init(km)
+	pool, err := db.ConnectDB()
+	if err != nil {
+		log.Fatalf("DB connection failed: %v", err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	rows, err := pool.Query(ctx,
+		`SELECT wallet_id, user_id::text, public_key, private_key_enc FROM wallets
+         WHERE private_key_enc IS NOT NULL AND private_key_enc NOT LIKE '{%'`)
+	if err != nil {
+		log.Fatalf("query wallets: %v", err)
+	}
+	var wallets []legacyWallet
+	for rows.Next() {
+		var lw legacyWallet
+		if err := rows.Scan(&lw.walletID, &lw.userID, &lw.publicKey, &lw.enc); err != nil {
+			log.Fatalf("scan wallets: %v", err)
+		}
+		wallets = append(wallets, lw)
+	}
+	rows.Close()
+
+	migrated, failed := 0, 0
+	for _, lw := range wallets {
+		d, err := envelope.OpenLegacy(lw.enc, lw.userID)
+		if err != nil {
+			failed++
+			log.Printf("wallet %s: cannot decrypt legacy key: %v", lw.walletID, err)
+			continue
+		}
+		priv, err := crypto.PrivateKeyFromBytes(d)
+		if err != nil || crypto.SerializePublicKey(&priv.PublicKey) != lw.publicKey {
+			failed++
+			log.Printf("wallet %s: decrypted key does not match the public key, left unchanged", lw.walletID)
+			continue
+		}
+		sealed, err := envelope.SealWithMaster(d)
+		if err != nil {
+			log.Fatalf("wallet %s: %v", lw.walletID, err)
+		}
+		if !*dryRun {
+			// Only replace the exact value read, in case it changed meanwhile.
+			tag, err := pool.Exec(ctx,
+				`UPDATE wallets SET private_key_enc=$3 WHERE wallet_id=$1 AND private_key_enc=$2`,
+				lw.walletID, lw.enc, sealed)
+			if err != nil {
+				log.Fatalf("wallet %s: %v", lw.walletID, err)
+			}
+			if tag.RowsAffected() == 0 {
+				log.Printf("wallet %s: changed during migration, skipped", lw.walletID)
+				continue
+			}
+		}
+		migrated++
+	}
+	log.Printf("%d legacy wallet keys: %d migrated, %d failed", len(wallets), migrated, failed)
+}
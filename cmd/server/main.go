@@ -3,11 +3,23 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/audit"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/block"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/db"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/explorer"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/invoice"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/kms"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/mempool"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/policy"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/pst"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/schedule"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/statement"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/zakat"
@@ -31,32 +43,98 @@ func main() {
 	}
 	//defer pool.Close() // close when the server exits
 
+	// Master keys for custodial wallet envelopes and server-side signing
+	km, err := kms.FromEnv()
+	if err != nil {
+		log.Fatalf("key manager: %v", err)
+	}
+	kms.Init(km)
+	// SIGHUP picks up keys added by cmd/kmsrotate
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			if err := km.Reload(); err != nil {
+				log.Printf("key manager reload: %v", err)
+				continue
+			}
+			log.Printf("key manager reloaded, current master key %s", km.CurrentKeyID())
+		}
+	}()
+
 	// pass pool into your handlers or initialize your auth package
 	auth.Init(pool)
 	wallet.Init(pool)
+	mempool.Init(pool)
+	fee.Init(pool)
+	tx.Init(pool)
 	block.Init(pool)
 	explorer.Init(pool)
 	zakat.Init(pool, "<zakat_wallet_id>")
+	schedule.Init(pool)
+	invoice.Init(pool)
+	pst.Init(pool)
+	policy.Init(pool)
+	statement.Init(pool)
+	audit.Init(pool)
 	mux := http.NewServeMux()
 	//Check API health
 	mux.HandleFunc("/health", health)
 	//Auth routes
 	mux.HandleFunc("/auth/register", auth.RegisterHandler)
 	mux.HandleFunc("/auth/verify-otp", auth.VerifyOTPHandler)
+	mux.Handle("/auth/reauth", auth.JWTMiddleware(http.HandlerFunc(auth.ReauthHandler)))
 	//Wallet routes
 	mux.Handle("/wallet/create", auth.JWTMiddleware(http.HandlerFunc(wallet.CreateHandler)))
 	mux.Handle("/wallet/list", auth.JWTMiddleware(http.HandlerFunc(wallet.ListHandler)))
 	mux.Handle("/wallet/detail", auth.JWTMiddleware(http.HandlerFunc(wallet.DetailHandler)))
 	mux.Handle("/wallet/utxos", auth.JWTMiddleware(http.HandlerFunc(wallet.UtxosHandler)))
 	mux.Handle("/wallet/txs", auth.JWTMiddleware(http.HandlerFunc(wallet.TxHistoryHandler)))
+	mux.Handle("/wallet/register/challenge", auth.JWTMiddleware(http.HandlerFunc(wallet.RegisterChallengeHandler)))
+	mux.Handle("/wallet/register", auth.JWTMiddleware(http.HandlerFunc(wallet.RegisterHandler)))
+	mux.Handle("/wallet/hd/init", auth.JWTMiddleware(http.HandlerFunc(wallet.HDInitHandler)))
+	mux.Handle("/wallet/hd/recover", auth.JWTMiddleware(http.HandlerFunc(wallet.HDRecoverHandler)))
+	mux.Handle("/wallet/passphrase", auth.JWTMiddleware(http.HandlerFunc(wallet.PassphraseHandler)))
+	mux.Handle("/wallet/meta", auth.JWTMiddleware(http.HandlerFunc(wallet.MetaHandler)))
+	mux.Handle("/wallet/contacts", auth.JWTMiddleware(http.HandlerFunc(wallet.ContactsHandler)))
+	mux.Handle("/wallet/watch", auth.JWTMiddleware(http.HandlerFunc(wallet.WatchHandler)))
+	mux.Handle("/wallet/policy", auth.JWTMiddleware(http.HandlerFunc(policy.Handler)))
+	mux.Handle("/wallet/statement", auth.JWTMiddleware(http.HandlerFunc(statement.Handler)))
+	mux.Handle("/wallet/export", auth.JWTMiddleware(http.HandlerFunc(wallet.ExportHandler)))
+	mux.Handle("/wallet/import", auth.JWTMiddleware(http.HandlerFunc(wallet.ImportHandler)))
+	mux.Handle("/wallet/consolidate", auth.JWTMiddleware(http.HandlerFunc(tx.ConsolidateHandler)))
+	mux.Handle("/wallet/rotate", auth.JWTMiddleware(http.HandlerFunc(tx.RotateHandler)))
 	//Transaction routes
 	mux.Handle("/tx/send", auth.JWTMiddleware(http.HandlerFunc(tx.SendHandler)))
+	mux.Handle("/tx/send-custodial", auth.JWTMiddleware(http.HandlerFunc(tx.CustodialSendHandler)))
 	mux.Handle("/tx/detail", auth.JWTMiddleware(http.HandlerFunc(tx.DetailHandler)))
 	mux.Handle("/tx/wallet", auth.JWTMiddleware(http.HandlerFunc(tx.WalletTxsHandler)))
+	mux.Handle("/tx/pst/upload", auth.JWTMiddleware(http.HandlerFunc(pst.UploadHandler)))
+	mux.Handle("/tx/pst/complete", auth.JWTMiddleware(http.HandlerFunc(pst.CompleteHandler)))
+	mux.Handle("/tx/pst/detail", auth.JWTMiddleware(http.HandlerFunc(pst.DetailHandler)))
+	//Scheduled payment routes
+	mux.Handle("/schedule/create", auth.JWTMiddleware(http.HandlerFunc(schedule.CreateHandler)))
+	mux.Handle("/schedule/list", auth.JWTMiddleware(http.HandlerFunc(schedule.ListHandler)))
+	mux.Handle("/schedule/pause", auth.JWTMiddleware(http.HandlerFunc(schedule.PauseHandler)))
+	mux.Handle("/schedule/resume", auth.JWTMiddleware(http.HandlerFunc(schedule.ResumeHandler)))
+	mux.Handle("/schedule/cancel", auth.JWTMiddleware(http.HandlerFunc(schedule.CancelHandler)))
+	//Invoice routes
+	mux.Handle("/invoice/create", auth.JWTMiddleware(http.HandlerFunc(invoice.CreateHandler)))
+	mux.Handle("/invoice/list", auth.JWTMiddleware(http.HandlerFunc(invoice.ListHandler)))
+	mux.Handle("/invoice/detail", auth.JWTMiddleware(http.HandlerFunc(invoice.DetailHandler)))
+	mux.HandleFunc("/invoice/decode", invoice.DecodeHandler)
+	//Fee policy routes
+	mux.HandleFunc("/fee/policy", fee.PolicyHandler)
+	mux.HandleFunc("/fee/estimate", fee.EstimateHandler)
+	mux.Handle("/fee/policy/update", auth.JWTMiddleware(http.HandlerFunc(fee.UpdateHandler)))
+	//Mempool routes
+	mux.HandleFunc("/mempool/list", mempool.ListHandler)
+	mux.HandleFunc("/mempool/stream", mempool.StreamHandler)
 	//Block routes
 	mux.Handle("/blocks/commit", auth.JWTMiddleware(http.HandlerFunc(block.CommitHandler)))
 	mux.HandleFunc("/blocks/latest", block.LatestHandler)
 	mux.HandleFunc("/blocks/detail", block.DetailHandler)
+	mux.HandleFunc("/blocks/validate", block.ValidateHandler)
 
 	//Explorer routes
 	mux.HandleFunc("/explorer/wallet/info", explorer.WalletInfoHandler)
@@ -0,0 +1,195 @@
+// Command sigmigrate rewrites stored signatures into the canonical form
+// enforced by the server: fixed-width 64-character hex r and s, with s in the
+// lower half of the curve order for ECDSA keys. A high-S signature (r, s) is
+// replaced by the equivalent (r, n-s). Each signature is checked under the key
+// type of its sender's wallet; those that do not verify after normalization
+// are flagged with signature_invalid=true instead of being changed.
+//
+//	go run ./cmd/sigmigrate [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/db"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
+)
+
+type counts struct {
+	checked, migrated, flagged int
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, relying on system environment")
+	}
+	pool, err := db.ConnectDB()
+	if err != nil {
+		log.Fatalf("DB connection failed: %v", err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	c, err := migrateTransactions(ctx, pool, *dryRun)
+	if err != nil {
+		log.Fatalf("transactions: %v", err)
+	}
+	log.Printf("transactions: %d checked, %d migrated, %d flagged", c.checked, c.migrated, c.flagged)
+
+	c, err = migrateMandates(ctx, pool, *dryRun)
+	if err != nil {
+		log.Fatalf("mandates: %v", err)
+	}
+	log.Printf("mandates: %d checked, %d migrated, %d flagged", c.checked, c.migrated, c.flagged)
+}
+
+// normalize returns canonical r and s hex for a stored signature by a key of
+// keyType, verified against payload. ok is false when the signature cannot be
+// made valid.
+func normalize(keyType, pubHex, payload, rHex, sHex string) (string, string, bool) {
+	pub, err := crypto.ParsePublicKey(keyType, pubHex)
+	if err != nil {
+		return "", "", false
+	}
+	r, rOk := new(big.Int).SetString(rHex, 16)
+	s, sOk := new(big.Int).SetString(sHex, 16)
+	if !rOk || !sOk || r.Sign() <= 0 || s.Sign() <= 0 {
+		return "", "", false
+	}
+	// Only ECDSA has an equivalent (r, n-s); Ed25519 signatures are kept as is
+	if curve := crypto.Curve(keyType); curve != nil {
+		s = crypto.NormalizeLowS(curve, s)
+	}
+	normR, normS := crypto.ScalarHex(r), crypto.ScalarHex(s)
+	if !pub.Verify([]byte(payload), normR, normS) {
+		return "", "", false
+	}
+	return normR, normS, true
+}
+
+func migrateTransactions(ctx context.Context, pool *pgxpool.Pool, dryRun bool) (counts, error) {
+	var c counts
+	rows, err := pool.Query(ctx,
+		`SELECT t.tx_id::text, COALESCE(w.key_type, '') FROM transactions t
+         LEFT JOIN wallets w ON w.wallet_id = t.from_wallet_id
+         WHERE t.kind <> $1 AND COALESCE(t.signature_r,'') <> '' AND NOT t.signature_invalid`, tx.KindSystem)
+	if err != nil {
+		return c, err
+	}
+	var ids, keyTypes []string
+	for rows.Next() {
+		var id, keyType string
+		if err := rows.Scan(&id, &keyType); err != nil {
+			rows.Close()
+			return c, err
+		}
+		ids = append(ids, id)
+		keyTypes = append(keyTypes, keyType)
+	}
+	rows.Close()
+
+	for i, id := range ids {
+		dbTx, err := pool.Begin(ctx)
+		if err != nil {
+			return c, err
+		}
+		rec, err := tx.LoadRecord(ctx, dbTx, id)
+		if err != nil {
+			dbTx.Rollback(ctx)
+			return c, err
+		}
+		c.checked++
+
+		r, s, ok := "", "", false
+		if payload, err := rec.SignedPayload(ctx, dbTx); err == nil {
+			r, s, ok = normalize(keyTypes[i], rec.SenderPub, payload, rec.SigR, rec.SigS)
+		}
+		switch {
+		case !ok:
+			c.flagged++
+			log.Printf("transaction %s: signature does not verify, flagging", id)
+			_, err = dbTx.Exec(ctx, `UPDATE transactions SET signature_invalid=true WHERE tx_id=$1::uuid`, id)
+		case r != rec.SigR || s != rec.SigS:
+			c.migrated++
+			_, err = dbTx.Exec(ctx,
+				`UPDATE transactions SET signature_r=$2, signature_s=$3 WHERE tx_id=$1::uuid`, id, r, s)
+		}
+		if err != nil {
+			dbTx.Rollback(ctx)
+			return c, err
+		}
+		if dryRun {
+			dbTx.Rollback(ctx)
+			continue
+		}
+		if err := dbTx.Commit(ctx); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+type mandate struct {
+	id, from, to, interval, note, ts, pub, keyType, sigR, sigS string
+	amount                                                     int64
+	startAt                                                    time.Time
+}
+
+func migrateMandates(ctx context.Context, pool *pgxpool.Pool, dryRun bool) (counts, error) {
+	var c counts
+	rows, err := pool.Query(ctx,
+		`SELECT m.mandate_id::text, m.from_wallet_id, m.to_wallet_id, m.amount, m.interval, m.start_at, m.timestamp, m.note,
+                m.sender_public_key, COALESCE(w.key_type, ''), m.signature_r, m.signature_s
+         FROM payment_mandates m
+         LEFT JOIN wallets w ON w.wallet_id = m.from_wallet_id
+         WHERE NOT m.signature_invalid`)
+	if err != nil {
+		return c, err
+	}
+	var mandates []mandate
+	for rows.Next() {
+		var m mandate
+		if err := rows.Scan(&m.id, &m.from, &m.to, &m.amount, &m.interval, &m.startAt, &m.ts, &m.note,
+			&m.pub, &m.keyType, &m.sigR, &m.sigS); err != nil {
+			rows.Close()
+			return c, err
+		}
+		mandates = append(mandates, m)
+	}
+	rows.Close()
+
+	for _, m := range mandates {
+		c.checked++
+		payload := tx.MandatePayload(m.from, m.to, m.amount, m.interval, m.startAt.UTC().Format(time.RFC3339), m.ts, m.note)
+		r, s, ok := normalize(m.keyType, m.pub, payload, m.sigR, m.sigS)
+		switch {
+		case !ok:
+			c.flagged++
+			log.Printf("mandate %s: signature does not verify, flagging", m.id)
+			if !dryRun {
+				_, err = pool.Exec(ctx, `UPDATE payment_mandates SET signature_invalid=true WHERE mandate_id=$1::uuid`, m.id)
+			}
+		case r != m.sigR || s != m.sigS:
+			c.migrated++
+			if !dryRun {
+				_, err = pool.Exec(ctx,
+					`UPDATE payment_mandates SET signature_r=$2, signature_s=$3 WHERE mandate_id=$1::uuid`, m.id, r, s)
+			}
+		}
+		if err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,413 @@
+// Command walletcli manages a wallet key on the owner's machine. The private
+// key never leaves the encrypted keystore file; the server only sees signed
+// requests.
+//
+//	walletcli keygen  -keystore me.json [-kdf scrypt|argon2id] [-key-type ECDSA_P256|ECDSA_SECP256K1|ED25519]
+//	walletcli address -keystore me.json
+//	walletcli register -keystore me.json [-server URL] [-token JWT]
+//	walletcli sign    -keystore me.json -to <wallet_id> -amount 500 [-fee 0] [-note ..] [-out req.json]
+//	walletcli submit  [-in req.json] [-server URL] [-token JWT]
+//	walletcli send    -keystore me.json -to <wallet_id> -amount 500 [-server URL] [-token JWT]
+//	walletcli pst-sign -keystore me.json [-in packet.txt]
+//
+// register proves possession of the keystore key to the server, so the wallet
+// can receive and send without the server ever holding the key. sign prints
+// the send request as JSON so it can be carried from an air-gapped machine and
+// submitted elsewhere. pst-sign adds this key's signature to a partially
+// signed transaction (see internal/pst) and prints the updated packet. The
+// passphrase is read from WALLETCLI_PASSPHRASE or prompted on the terminal;
+// the server URL and JWT default to WALLET_SERVER and WALLET_TOKEN.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/keystore"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/pst"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch cmd {
+	case "keygen":
+		err = keygen(args)
+	case "address":
+		err = showAddress(args)
+	case "register":
+		err = register(args)
+	case "sign":
+		err = sign(args)
+	case "submit":
+		err = submit(args)
+	case "send":
+		err = send(args)
+	case "pst-sign":
+		err = pstSign(args)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "walletcli:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: walletcli keygen|address|register|sign|submit|send|pst-sign [flags]")
+	os.Exit(2)
+}
+
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	path := fs.String("keystore", "wallet.json", "keystore file to create")
+	kdf := fs.String("kdf", keystore.KDFScrypt, "scrypt or argon2id")
+	keyType := fs.String("key-type", crypto.KeyTypeP256, strings.Join(crypto.KeyTypes(), ", "))
+	fs.Parse(args)
+
+	params := keystore.DefaultScrypt()
+	if *kdf == keystore.KDFArgon2id {
+		params = keystore.DefaultArgon2id()
+	} else if *kdf != keystore.KDFScrypt {
+		return fmt.Errorf("unknown kdf %q", *kdf)
+	}
+	kt, err := crypto.LookupKeyType(*keyType)
+	if err != nil {
+		return err
+	}
+
+	pass, err := passphrase(true)
+	if err != nil {
+		return err
+	}
+	priv, err := kt.Generate()
+	if err != nil {
+		return err
+	}
+	ks, err := keystore.Seal(priv.Bytes(), priv.Public().Hex(), kt.Name(), pass, params)
+	if err != nil {
+		return err
+	}
+	if err := ks.Save(*path); err != nil {
+		return err
+	}
+	fmt.Printf("wallet_id:  %s\npublic_key: %s\nkey_type:   %s\nkeystore:   %s\n", ks.WalletID, ks.PublicKey, ks.KeyType, *path)
+	return nil
+}
+
+func showAddress(args []string) error {
+	fs := flag.NewFlagSet("address", flag.ExitOnError)
+	path := fs.String("keystore", "wallet.json", "keystore file")
+	fs.Parse(args)
+
+	ks, err := keystore.Load(*path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("address:    %s\nwallet_id:  %s\npublic_key: %s\n", address.For(ks.WalletID), ks.WalletID, ks.PublicKey)
+	return nil
+}
+
+func register(args []string) error {
+	fs := flag.NewFlagSet("register", flag.ExitOnError)
+	path := fs.String("keystore", "wallet.json", "keystore file")
+	server := fs.String("server", envOr("WALLET_SERVER", "http://localhost:8080"), "server base URL")
+	token := fs.String("token", os.Getenv("WALLET_TOKEN"), "JWT from /auth/verify-otp")
+	fs.Parse(args)
+
+	ks, err := keystore.Load(*path)
+	if err != nil {
+		return err
+	}
+	priv, err := unlock(ks)
+	if err != nil {
+		return err
+	}
+
+	var ch struct {
+		ChallengeID string `json:"challenge_id"`
+		Challenge   string `json:"challenge"`
+	}
+	raw, err := call(*server, *token, "/wallet/register/challenge", wallet.ChallengeRequest{PublicKey: ks.PublicKey, KeyType: ks.KeyType})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &ch); err != nil {
+		return fmt.Errorf("unexpected challenge response: %w", err)
+	}
+
+	// Sign the payload rebuilt locally, never one supplied by the server.
+	req := wallet.RegisterRequest{ChallengeID: ch.ChallengeID, PublicKey: ks.PublicKey}
+	req.SignatureR, req.SignatureS, err = priv.Sign([]byte(wallet.RegisterPayload(ks.PublicKey, ch.Challenge)))
+	if err != nil {
+		return err
+	}
+	return post(*server, *token, "/wallet/register", req)
+}
+
+type signFlags struct {
+	keystore, to, note, nonce, timestamp, invoice *string
+	amount, fee                                   *int64
+}
+
+func addSignFlags(fs *flag.FlagSet) signFlags {
+	return signFlags{
+		keystore:  fs.String("keystore", "wallet.json", "keystore file"),
+		to:        fs.String("to", "", "recipient address or wallet_id"),
+		amount:    fs.Int64("amount", 0, "amount in smallest units"),
+		fee:       fs.Int64("fee", 0, "fee; 0 lets the server apply its fee policy"),
+		note:      fs.String("note", "", "note (signed)"),
+		nonce:     fs.String("nonce", "", "idempotency key; random if empty"),
+		timestamp: fs.String("timestamp", "", "RFC3339 timestamp (signed); now if empty"),
+		invoice:   fs.String("invoice", "", "invoice ID being paid"),
+	}
+}
+
+// buildRequest signs a send request with the keystore key.
+func buildRequest(f signFlags) (*tx.SendRequest, error) {
+	if *f.to == "" || *f.amount <= 0 {
+		return nil, errors.New("-to and a positive -amount are required")
+	}
+	// The payload is signed over the wallet ID, so resolve an address first
+	to, err := address.Parse(*f.to)
+	if err != nil {
+		return nil, fmt.Errorf("-to: %w", err)
+	}
+	ks, err := keystore.Load(*f.keystore)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := unlock(ks)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &tx.SendRequest{
+		FromWalletID: ks.WalletID,
+		ToWalletID:   to,
+		Amount:       *f.amount,
+		Fee:          *f.fee,
+		Nonce:        *f.nonce,
+		Timestamp:    *f.timestamp,
+		Note:         *f.note,
+		InvoiceID:    *f.invoice,
+	}
+	if req.Nonce == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		req.Nonce = hex.EncodeToString(b)
+	}
+	if req.Timestamp == "" {
+		req.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	payload := tx.CanonicalPayload(req.FromWalletID, req.ToWalletID, req.Amount, req.Timestamp, req.Note)
+	req.SignatureR, req.SignatureS, err = priv.Sign([]byte(payload))
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func sign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	f := addSignFlags(fs)
+	out := fs.String("out", "", "write the signed request here instead of stdout")
+	fs.Parse(args)
+
+	req, err := buildRequest(f)
+	if err != nil {
+		return err
+	}
+	raw, _ := json.MarshalIndent(req, "", "  ")
+	raw = append(raw, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(raw)
+		return err
+	}
+	return os.WriteFile(*out, raw, 0o600)
+}
+
+func submit(args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	in := fs.String("in", "", "signed request file; stdin if empty")
+	server := fs.String("server", envOr("WALLET_SERVER", "http://localhost:8080"), "server base URL")
+	token := fs.String("token", os.Getenv("WALLET_TOKEN"), "JWT from /auth/verify-otp")
+	fs.Parse(args)
+
+	var raw []byte
+	var err error
+	if *in == "" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		return err
+	}
+	var req tx.SendRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return fmt.Errorf("invalid request file: %w", err)
+	}
+	return post(*server, *token, "/tx/send", &req)
+}
+
+func send(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	f := addSignFlags(fs)
+	server := fs.String("server", envOr("WALLET_SERVER", "http://localhost:8080"), "server base URL")
+	token := fs.String("token", os.Getenv("WALLET_TOKEN"), "JWT from /auth/verify-otp")
+	fs.Parse(args)
+
+	req, err := buildRequest(f)
+	if err != nil {
+		return err
+	}
+	return post(*server, *token, "/tx/send", req)
+}
+
+func pstSign(args []string) error {
+	fs := flag.NewFlagSet("pst-sign", flag.ExitOnError)
+	path := fs.String("keystore", "wallet.json", "keystore file")
+	in := fs.String("in", "", "encoded packet file; stdin if empty (set WALLETCLI_PASSPHRASE)")
+	fs.Parse(args)
+
+	var raw []byte
+	var err error
+	if *in == "" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		return err
+	}
+	packet, err := pst.Decode(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s -> %s amount=%d fee=%d note=%q\n", packet.From, packet.To, packet.Amount, packet.Fee, packet.Note)
+
+	ks, err := keystore.Load(*path)
+	if err != nil {
+		return err
+	}
+	priv, err := unlock(ks)
+	if err != nil {
+		return err
+	}
+	if err := packet.Sign(priv); err != nil {
+		return err
+	}
+	encoded, err := packet.Encode()
+	if err != nil {
+		return err
+	}
+	fmt.Println(encoded)
+	return nil
+}
+
+// unlock opens the keystore with the passphrase and rebuilds its key.
+func unlock(ks *keystore.File) (crypto.PrivateKey, error) {
+	kt, err := crypto.LookupKeyType(ks.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := passphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	d, err := ks.Open(pass)
+	if err != nil {
+		return nil, err
+	}
+	return kt.PrivateKeyFromBytes(d)
+}
+
+// post sends body as JSON and copies the response to stdout.
+func post(server, token, path string, body any) error {
+	respBody, err := call(server, token, path, body)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(respBody)
+	return nil
+}
+
+// call sends body as JSON and returns the response body.
+func call(server, token, path string, body any) ([]byte, error) {
+	if token == "" {
+		return nil, errors.New("a JWT is required (-token or WALLET_TOKEN)")
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimRight(server, "/")+path, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("server: %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+func passphrase(confirm bool) (string, error) {
+	if p := os.Getenv("WALLETCLI_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	in := bufio.NewReader(os.Stdin)
+	fmt.Fprint(os.Stderr, "passphrase: ")
+	p, err := in.ReadString('\n')
+	if err != nil && p == "" {
+		return "", err
+	}
+	p = strings.TrimRight(p, "\r\n")
+	if p == "" {
+		return "", errors.New("empty passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "repeat passphrase: ")
+		again, _ := in.ReadString('\n')
+		if strings.TrimRight(again, "\r\n") != p {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return p, nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
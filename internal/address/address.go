@@ -0,0 +1,221 @@
+// Package address encodes wallet IDs as checksummed, human-readable
+// addresses.
+//
+// An address is the 32-byte wallet hash in Bech32m (BIP-350) with the
+// network prefix from WALLET_ADDRESS_HRP as its human-readable part, e.g.
+// cw1qf3...; the six-character checksum catches typos and the prefix catches
+// addresses meant for another network. Raw 64-character hex wallet IDs are
+// still accepted on input.
+package address
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultHRP is the prefix used when WALLET_ADDRESS_HRP is unset.
+const DefaultHRP = "cw"
+
+var (
+	ErrFormat       = errors.New("invalid address")
+	ErrChecksum     = errors.New("address checksum mismatch")
+	ErrWrongNetwork = errors.New("address is for a different network")
+)
+
+const (
+	charset        = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32mConst   = 0x2bc830a3
+	checksumLength = 6
+	walletIDLength = 32
+)
+
+// HRP returns the network prefix from WALLET_ADDRESS_HRP.
+func HRP() string {
+	hrp := strings.ToLower(strings.TrimSpace(os.Getenv("WALLET_ADDRESS_HRP")))
+	if hrp == "" || len(hrp) > 20 || strings.Trim(hrp, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return DefaultHRP
+	}
+	return hrp
+}
+
+func polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := range 5 {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := range len(hrp) {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := range len(hrp) {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits regroups a byte slice from one bit width to another.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<to - 1
+	var out []byte
+	for _, b := range data {
+		if uint(b)>>from != 0 {
+			return nil, ErrFormat
+		}
+		acc = acc<<from | uint(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, ErrFormat
+	}
+	return out, nil
+}
+
+// Encode turns a hex wallet ID into an address on this network.
+func Encode(walletID string) (string, error) {
+	raw, err := hex.DecodeString(walletID)
+	if err != nil || len(raw) != walletIDLength {
+		return "", ErrFormat
+	}
+	data, err := convertBits(raw, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return encode(HRP(), data), nil
+}
+
+// encode is Bech32m: hrp, the separator, then the 5-bit data and checksum.
+func encode(hrp string, data []byte) string {
+	values := append(hrpExpand(hrp), data...)
+	mod := polymod(append(values, make([]byte, checksumLength)...)) ^ bech32mConst
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, d := range data {
+		b.WriteByte(charset[d])
+	}
+	for i := range checksumLength {
+		b.WriteByte(charset[mod>>(5*(5-i))&31])
+	}
+	return b.String()
+}
+
+// For returns the address of a wallet ID, or "" if it is not a wallet hash.
+func For(walletID string) string {
+	addr, err := Encode(walletID)
+	if err != nil {
+		return ""
+	}
+	return addr
+}
+
+// Decode validates an address and returns its hex wallet ID.
+func Decode(addr string) (string, error) {
+	hrp, data, err := decode(addr)
+	if err != nil {
+		return "", err
+	}
+	if hrp != HRP() {
+		return "", ErrWrongNetwork
+	}
+	raw, err := convertBits(data, 5, 8, false)
+	if err != nil || len(raw) != walletIDLength {
+		return "", ErrFormat
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// decode checks a Bech32m string and returns its lowercased hrp and its 5-bit
+// data without the checksum.
+func decode(s string) (string, []byte, error) {
+	if len(s) > 90 || (strings.ToLower(s) != s && strings.ToUpper(s) != s) {
+		return "", nil, ErrFormat
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || len(s)-sep-1 < checksumLength {
+		return "", nil, ErrFormat
+	}
+	hrp, rest := s[:sep], s[sep+1:]
+	for i := range len(hrp) {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, ErrFormat
+		}
+	}
+	values := make([]byte, len(rest))
+	for i := range len(rest) {
+		d := strings.IndexByte(charset, rest[i])
+		if d < 0 {
+			return "", nil, ErrFormat
+		}
+		values[i] = byte(d)
+	}
+	if polymod(append(hrpExpand(hrp), values...)) != bech32mConst {
+		return "", nil, ErrChecksum
+	}
+	return hrp, values[:len(values)-checksumLength], nil
+}
+
+// Parse accepts an address or a raw hex wallet ID and returns the wallet ID.
+func Parse(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 2*walletIDLength {
+		if raw, err := hex.DecodeString(s); err == nil {
+			return hex.EncodeToString(raw), nil
+		}
+	}
+	if strings.Contains(s, "1") {
+		return Decode(s)
+	}
+	return "", ErrFormat
+}
+
+// Normalize rewrites each non-empty field in place from an address or hex
+// wallet ID to the wallet ID.
+func Normalize(fields ...*string) error {
+	for _, f := range fields {
+		if *f == "" {
+			continue
+		}
+		id, err := Parse(*f)
+		if err != nil {
+			return err
+		}
+		*f = id
+	}
+	return nil
+}
+
+// FromQuery reads a wallet ID query parameter given as an address or hex.
+// A missing parameter returns "" and no error.
+func FromQuery(r *http.Request, name string) (string, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return "", nil
+	}
+	return Parse(v)
+}
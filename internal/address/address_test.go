@@ -0,0 +1,109 @@
+package address
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// BIP-350 test vectors.
+func TestDecodeBech32mVectors(t *testing.T) {
+	valid := []string{
+		"A1LQFN3A",
+		"a1lqfn3a",
+		"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6",
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+		"11llllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllludsr8",
+		"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		"?1v759aa",
+	}
+	for _, s := range valid {
+		hrp, data, err := decode(s)
+		if err != nil {
+			t.Errorf("decode(%q): %v", s, err)
+			continue
+		}
+		if got := encode(hrp, data); got != strings.ToLower(s) {
+			t.Errorf("encode(decode(%q)) = %q", s, got)
+		}
+	}
+
+	invalid := []struct {
+		s    string
+		why  string
+		want error
+	}{
+		{"\x201xj0phk", "hrp character out of range", ErrFormat},
+		{"\x7f1g6xzxy", "hrp character out of range", ErrFormat},
+		{"\x801vctc34", "hrp character out of range", ErrFormat},
+		{"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11d6pts4", "overall max length exceeded", ErrFormat},
+		{"qyrz8wqd2c9m", "no separator character", ErrFormat},
+		{"1qyrz8wqd2c9m", "empty hrp", ErrFormat},
+		{"y1b0jsk6g", "invalid data character", ErrFormat},
+		{"lt1igcx5c0", "invalid data character", ErrFormat},
+		{"in1muywd", "too short checksum", ErrFormat},
+		{"mm1crxm3i", "invalid character in checksum", ErrFormat},
+		{"au1s5cgom", "invalid character in checksum", ErrFormat},
+		{"M1VUXWEZ", "checksum calculated with uppercase hrp", ErrChecksum},
+		{"16plkw9", "empty hrp", ErrFormat},
+		{"1p2gdwpf", "empty hrp", ErrFormat},
+		{"a12uel5l", "valid Bech32, not Bech32m", ErrChecksum},
+		{"A1lqfn3a", "mixed case", ErrFormat},
+	}
+	for _, tc := range invalid {
+		if _, _, err := decode(tc.s); !errors.Is(err, tc.want) {
+			t.Errorf("decode(%q) (%s) = %v, want %v", tc.s, tc.why, err, tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Setenv("WALLET_ADDRESS_HRP", "")
+	const id = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	addr, err := Encode(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(addr, DefaultHRP+"1") || len(addr) != len(DefaultHRP)+1+52+checksumLength {
+		t.Fatalf("Encode(%s) = %q", id, addr)
+	}
+
+	flipped := []byte(addr)
+	last := len(flipped) - 1
+	flipped[last] = charset[(strings.IndexByte(charset, flipped[last])+1)%32]
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  error
+	}{
+		{"address", addr, id, nil},
+		{"uppercase address", strings.ToUpper(addr), id, nil},
+		{"surrounding space", " " + addr + "\n", id, nil},
+		{"hex", id, id, nil},
+		{"uppercase hex", strings.ToUpper(id), id, nil},
+		{"typo", string(flipped), "", ErrChecksum},
+		{"short hex", id[:62], "", ErrFormat},
+		{"empty", "", "", ErrFormat},
+		{"wrong payload length", encode(DefaultHRP, make([]byte, 10)), "", ErrFormat},
+	}
+	for _, tc := range tests {
+		got, err := Parse(tc.in)
+		if got != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("%s: Parse(%q) = %q, %v; want %q, %v", tc.name, tc.in, got, err, tc.want, tc.err)
+		}
+	}
+
+	t.Setenv("WALLET_ADDRESS_HRP", "tcw")
+	if _, err := Parse(addr); !errors.Is(err, ErrWrongNetwork) {
+		t.Errorf("Parse on another network = %v, want %v", err, ErrWrongNetwork)
+	}
+	other, err := Encode(id)
+	if err != nil || !strings.HasPrefix(other, "tcw1") {
+		t.Fatalf("Encode with WALLET_ADDRESS_HRP=tcw = %q, %v", other, err)
+	}
+	if got, err := Parse(other); got != id || err != nil {
+		t.Errorf("Parse(%q) = %q, %v", other, got, err)
+	}
+}
@@ -0,0 +1,125 @@
+// Package audit records security-relevant actions, such as key export, in
+// system_logs with type 'audit'.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var dbPool *pgxpool.Pool
+
+func Init(pool *pgxpool.Pool) { dbPool = pool }
+
+// Outcomes.
+const (
+	Success = "success"
+	Denied  = "denied"
+	Failed  = "failed"
+)
+
+type Event struct {
+	Action   string         `json:"action"` // e.g. wallet.export
+	Outcome  string         `json:"outcome"`
+	UserID   string         `json:"user_id,omitempty"`
+	WalletID string         `json:"wallet_id,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+	RemoteIP string         `json:"remote_ip,omitempty"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+// Record writes an audit event. Callers performing the audited action should
+// abort it when Record fails, so nothing happens without a trail.
+func Record(ctx context.Context, e Event) error {
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("%s %s", e.Action, e.Outcome)
+	if e.WalletID != "" {
+		msg += " for wallet " + e.WalletID
+	}
+	if e.UserID != "" {
+		msg += " by user " + e.UserID
+	}
+	_, err = dbPool.Exec(ctx,
+		`INSERT INTO system_logs (id, type, message, metadata, timestamp)
+         VALUES (gen_random_uuid(),'audit',$1,$2,NOW())`,
+		msg, string(meta))
+	return err
+}
+
+// RemoteIP returns the client address. X-Forwarded-For is only believed when
+// the direct peer is a trusted proxy; the client is then the nearest address
+// in the chain that is not one.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trusted(host) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !trusted(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+var (
+	proxiesOnce sync.Once
+	proxies     []netip.Prefix
+)
+
+// trusted reports whether ip is listed in TRUSTED_PROXIES, a comma-separated
+// list of IPs and CIDR ranges. Unset trusts no proxy.
+func trusted(ip string) bool {
+	proxiesOnce.Do(func() {
+		for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if !strings.Contains(v, "/") {
+				if a, err := netip.ParseAddr(v); err == nil {
+					v = netip.PrefixFrom(a, a.BitLen()).String()
+				}
+			}
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				log.Printf("TRUSTED_PROXIES: ignoring %q", v)
+				continue
+			}
+			proxies = append(proxies, p.Masked())
+		}
+	})
+	a, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	a = a.Unmap()
+	for _, p := range proxies {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IsAdmin reports whether the token belongs to an operator listed in the
+// comma-separated ADMIN_EMAILS environment variable.
+func IsAdmin(claims jwt.MapClaims) bool {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return false
+	}
+	for _, a := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if strings.EqualFold(strings.TrimSpace(a), email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Purposes a re-authentication OTP can be issued for. A code only confirms
+// the action it was requested for.
+const (
+	PurposePolicyChange   = "policy_change"
+	PurposePolicyOverride = "policy_override"
+	PurposeCustodialSend  = "custodial_send"
+)
+
+var purposes = map[string]bool{
+	PurposePolicyChange:   true,
+	PurposePolicyOverride: true,
+	PurposeCustodialSend:  true,
+}
+
+const (
+	reauthTTL       = 5 * time.Minute
+	maxOTPAttempts  = 5
+	otpLockDuration = 15 * time.Minute
+)
+
+var (
+	ErrInvalidOTP = errors.New("invalid or expired OTP")
+	ErrOTPLocked  = errors.New("too many failed OTP attempts, try again later")
+)
+
+// ✅ Email a fresh OTP to the signed-in user to confirm a sensitive action
+// (POST {"purpose": "policy_change" | "policy_override" | "custodial_send"})
+func ReauthHandler(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req struct {
+		Purpose string `json:"purpose"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !purposes[req.Purpose] {
+		http.Error(w, "unknown purpose", http.StatusBadRequest)
+		return
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		http.Error(w, "otp error", http.StatusInternalServerError)
+		return
+	}
+	otp := fmt.Sprintf("%06d", n.Int64())
+
+	ctx := context.Background()
+	var email string
+	err = dbPool.QueryRow(ctx, `select email from users where id=$1`, userID).Scan(&email)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	// A new code replaces the old one but keeps its failed attempts, and none
+	// is issued while the purpose is locked.
+	var issued bool
+	err = dbPool.QueryRow(ctx,
+		`insert into reauth_codes (user_id, purpose, code_hash, expires_at)
+         values ($1, $2, $3, $4)
+         on conflict (user_id, purpose) do update
+         set code_hash=excluded.code_hash, expires_at=excluded.expires_at, locked_until=null
+         where reauth_codes.locked_until is null or reauth_codes.locked_until <= now()
+         returning true`,
+		userID, req.Purpose, hashOTP(userID, req.Purpose, otp), time.Now().Add(reauthTTL)).Scan(&issued)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, ErrOTPLocked.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := sendEmailSMTP(email, otp); err != nil {
+		log.Printf("Failed to send email: %v", err)
+		http.Error(w, "failed to send OTP email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "OTP sent"})
+}
+
+// ConsumeOTP checks a re-authentication OTP issued for purpose and clears it
+// so it works once. Each wrong or expired code counts as a failed attempt;
+// after maxOTPAttempts the purpose is locked for otpLockDuration and
+// ErrOTPLocked is returned until then.
+func ConsumeOTP(ctx context.Context, userID, purpose, otp string) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var codeHash *string
+	var expires, lockedUntil *time.Time
+	var attempts int
+	err = tx.QueryRow(ctx,
+		`select code_hash, expires_at, attempts, locked_until from reauth_codes
+         where user_id=$1 and purpose=$2 for update`, userID, purpose).
+		Scan(&codeHash, &expires, &attempts, &lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidOTP
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if lockedUntil != nil && lockedUntil.After(now) {
+		return ErrOTPLocked
+	}
+
+	if otp != "" && codeHash != nil && expires != nil && expires.After(now) &&
+		subtle.ConstantTimeCompare([]byte(*codeHash), []byte(hashOTP(userID, purpose, otp))) == 1 {
+		if _, err := tx.Exec(ctx,
+			`update reauth_codes set code_hash=null, expires_at=null, attempts=0, locked_until=null
+             where user_id=$1 and purpose=$2`, userID, purpose); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+
+	attempts++
+	result := ErrInvalidOTP
+	if attempts >= maxOTPAttempts {
+		// Locking also burns the current code
+		_, err = tx.Exec(ctx,
+			`update reauth_codes set code_hash=null, expires_at=null, attempts=0, locked_until=$3
+             where user_id=$1 and purpose=$2`, userID, purpose, now.Add(otpLockDuration))
+		result = ErrOTPLocked
+	} else {
+		_, err = tx.Exec(ctx,
+			`update reauth_codes set attempts=$3 where user_id=$1 and purpose=$2`, userID, purpose, attempts)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return result
+}
+
+// hashOTP binds a code to its user and purpose; only the hash is stored.
+func hashOTP(userID, purpose, otp string) string {
+	sum := sha256.Sum256([]byte(userID + "|" + purpose + "|" + otp))
+	return hex.EncodeToString(sum[:])
+}
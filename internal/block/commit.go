@@ -14,6 +14,9 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/mempool"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/sigverify"
+	txpkg "github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
 )
 
 var dbPool *pgxpool.Pool
@@ -26,15 +29,22 @@ type CommitRequest struct {
 }
 
 type CommitResponse struct {
-	BlockID    string   `json:"block_id"`
-	Height     int      `json:"height"`
-	PrevHash   string   `json:"prev_hash"`
-	Hash       string   `json:"hash"`
-	Nonce      int64    `json:"nonce"`
-	Difficulty int      `json:"difficulty"`
-	TxIDs      []string `json:"tx_ids"`
-	Count      int      `json:"count"`
-	Timestamp  string   `json:"timestamp"`
+	BlockID    string       `json:"block_id"`
+	Height     int          `json:"height"`
+	PrevHash   string       `json:"prev_hash"`
+	Hash       string       `json:"hash"`
+	Nonce      int64        `json:"nonce"`
+	Difficulty int          `json:"difficulty"`
+	TxIDs      []string     `json:"tx_ids"`
+	Count      int          `json:"count"`
+	Timestamp  string       `json:"timestamp"`
+	Rejected   []RejectedTx `json:"rejected,omitempty"`
+}
+
+// RejectedTx is a pending transaction dropped by commit-time re-validation.
+type RejectedTx struct {
+	TxID   string `json:"tx_id"`
+	Reason string `json:"reason"`
 }
 
 func CommitHandler(w http.ResponseWriter, r *http.Request) {
@@ -69,31 +79,127 @@ func CommitHandler(w http.ResponseWriter, r *http.Request) {
 		latestHeight = -1
 	}
 
-	q := `SELECT tx_id::text FROM transactions WHERE status='pending' ORDER BY created_at ASC`
-	if req.MaxTx > 0 {
-		q += fmt.Sprintf(" LIMIT %d", req.MaxTx)
+	// Transactions that waited too long never make it into a block.
+	expired, err := txpkg.ExpireStale(ctx, tx)
+	if err != nil {
+		http.Error(w, "db expire tx error", http.StatusInternalServerError)
+		return
+	}
+	for _, id := range expired {
+		mempool.Default.Remove(id, txpkg.StatusExpired)
+	}
+
+	// Take the best-paying transactions from the mempool, then lock the rows
+	// that are still pending. Anything the database no longer has as pending
+	// is stale and dropped from the mempool.
+	var candidates []string
+	for _, e := range mempool.Default.Top(req.MaxTx) {
+		candidates = append(candidates, e.TxID)
+	}
+	if len(candidates) == 0 {
+		http.Error(w, "no pending transactions", http.StatusBadRequest)
+		return
 	}
-	rows, err := tx.Query(ctx, q)
+	rows, err := tx.Query(ctx,
+		`SELECT tx_id::text FROM transactions
+         WHERE tx_id = ANY($1::uuid[]) AND status='pending'
+         ORDER BY created_at ASC
+         FOR UPDATE`, candidates)
 	if err != nil {
 		http.Error(w, "db query pending tx error", http.StatusInternalServerError)
 		return
 	}
 
-	var txIDs []string
+	var pending []string
+	stillPending := map[string]bool{}
 	for rows.Next() {
 		var id string
 		if err := rows.Scan(&id); err != nil {
 			http.Error(w, "db scan error", http.StatusInternalServerError)
 			return
 		}
-		txIDs = append(txIDs, id)
+		pending = append(pending, id)
+		stillPending[id] = true
 	}
 	rows.Close()
-	if len(txIDs) == 0 {
+	for _, id := range candidates {
+		if !stillPending[id] {
+			mempool.Default.Remove(id, "stale")
+		}
+	}
+	if len(pending) == 0 {
 		http.Error(w, "no pending transactions", http.StatusBadRequest)
 		return
 	}
 
+	// Check every signature up front on the worker pool. Verify below then
+	// finds the results in the verified-signature cache.
+	jobs, err := txpkg.SignatureJobs(ctx, tx, pending)
+	if err != nil {
+		http.Error(w, "db load signatures error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := sigverify.Default.VerifyBatch(ctx, jobs); err != nil {
+		http.Error(w, "signature verification cancelled", http.StatusInternalServerError)
+		return
+	}
+
+	// Re-validate in arrival order so a rejection is visible to the transactions
+	// that spend its outputs later in the same batch. A transaction whose parent
+	// is still pending outside this block waits for a later block.
+	var txIDs []string
+	var rejected []RejectedTx
+	inBlock := map[string]bool{}
+	for _, id := range pending {
+		parents, err := txpkg.PendingParents(ctx, tx, id)
+		if err != nil {
+			http.Error(w, "db query parents error", http.StatusInternalServerError)
+			return
+		}
+		deferred := false
+		for _, p := range parents {
+			if !inBlock[p] {
+				deferred = true
+			}
+		}
+		if deferred {
+			continue
+		}
+
+		rec, err := txpkg.LoadRecord(ctx, tx, id)
+		if err != nil {
+			http.Error(w, "db load tx error", http.StatusInternalServerError)
+			return
+		}
+		if verr := rec.Verify(ctx, tx); verr != nil {
+			if err := txpkg.Reject(ctx, tx, id, verr.Error()); err != nil {
+				http.Error(w, "db reject tx error", http.StatusInternalServerError)
+				return
+			}
+			rejected = append(rejected, RejectedTx{TxID: id, Reason: verr.Error()})
+			continue
+		}
+		txIDs = append(txIDs, id)
+		inBlock[id] = true
+	}
+	if len(txIDs) == 0 {
+		// Keep the rejections even though there is nothing to mine.
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "db commit error", http.StatusInternalServerError)
+			return
+		}
+		for _, rj := range rejected {
+			mempool.Default.Remove(rj.TxID, txpkg.StatusRejected)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":    "no valid pending transactions",
+			"rejected": rejected,
+		})
+		return
+	}
+
 	nextHeight := latestHeight + 1
 	timestamp := time.Now().UTC().Format(time.RFC3339)
 	merkleRoot := ComputeMerkleRoot(txIDs)
@@ -124,11 +230,14 @@ func CommitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = tx.Exec(ctx,
-		`UPDATE transactions SET status='committed', block_id=$1 WHERE tx_id = ANY($2::uuid[])`,
-		blockID, txIDs)
-	if err != nil {
-		http.Error(w, "db update tx error", http.StatusInternalServerError)
+	for _, id := range txIDs {
+		if err := txpkg.SetStatus(ctx, tx, id, txpkg.StatusCommitted, fmt.Sprintf("block %d", nextHeight), blockID); err != nil {
+			http.Error(w, "db update tx error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if _, err := txpkg.PromoteConfirmed(ctx, tx, nextHeight); err != nil {
+		http.Error(w, "db confirm tx error", http.StatusInternalServerError)
 		return
 	}
 
@@ -136,6 +245,12 @@ func CommitHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "db commit error", http.StatusInternalServerError)
 		return
 	}
+	for _, id := range txIDs {
+		mempool.Default.Remove(id, txpkg.StatusCommitted)
+	}
+	for _, rj := range rejected {
+		mempool.Default.Remove(rj.TxID, txpkg.StatusRejected)
+	}
 
 	resp := CommitResponse{
 		BlockID:    blockID,
@@ -147,6 +262,7 @@ func CommitHandler(w http.ResponseWriter, r *http.Request) {
 		TxIDs:      txIDs,
 		Count:      len(txIDs),
 		Timestamp:  timestamp,
+		Rejected:   rejected,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -1,15 +1,18 @@
 package crypto
 
 import (
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
-	"errors"
 	"math/big"
 )
 
+// CurveP256 is the curve wallet keys are generated on
+func CurveP256() elliptic.Curve { return elliptic.P256() }
+
 // GenerateKeypair creates a new ECDSA P-256 keypair
 func GenerateKeypair() (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
 	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
@@ -44,13 +47,32 @@ func SerializePublicKey(pub *ecdsa.PublicKey) string {
 func DeserializePublicKey(hexStr string) (*ecdsa.PublicKey, error) {
 	b, err := hex.DecodeString(hexStr)
 	if err != nil || len(b) != 65 || b[0] != 0x04 {
-		return nil, errors.New("invalid public key encoding")
+		return nil, ErrInvalidPublicKey
 	}
 	x := new(big.Int).SetBytes(b[1:33])
 	y := new(big.Int).SetBytes(b[33:])
 	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
 }
 
+// PrivateKeyBytes returns the private scalar D padded to 32 bytes
+func PrivateKeyBytes(priv *ecdsa.PrivateKey) []byte {
+	return priv.D.FillBytes(make([]byte, 32))
+}
+
+// PrivateKeyFromBytes rebuilds a P-256 private key from its 32-byte scalar
+func PrivateKeyFromBytes(d []byte) (*ecdsa.PrivateKey, error) {
+	// crypto/ecdh validates the scalar and computes the public point
+	k, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	pub, err := DeserializePublicKey(hex.EncodeToString(k.PublicKey().Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(d)}, nil
+}
+
 // WalletHashFromPublicKeyHex derives a wallet ID by hashing the public key with SHA-256
 func WalletHashFromPublicKeyHex(pubHex string) string {
 	b, _ := hex.DecodeString(pubHex)
@@ -58,17 +80,20 @@ func WalletHashFromPublicKeyHex(pubHex string) string {
 	return hex.EncodeToString(sum[:])
 }
 
-// SignPayload signs a payload using the private key, returning r and s as hex strings
+// SignPayload signs a payload using the private key, returning r and s as
+// fixed-width 64-character hex strings with s normalized to low-S
 func SignPayload(priv *ecdsa.PrivateKey, payload []byte) (string, string, error) {
 	h := sha256.Sum256(payload)
 	r, s, err := ecdsa.Sign(rand.Reader, priv, h[:])
 	if err != nil {
 		return "", "", err
 	}
-	return r.Text(16), s.Text(16), nil
+	s = NormalizeLowS(priv.Curve, s)
+	return ScalarHex(r), ScalarHex(s), nil
 }
 
-// VerifySignature verifies a signature (r,s hex) against a payload and public key
+// VerifySignature verifies a signature (r,s hex) against a payload and public key.
+// High-S signatures are rejected even if they would otherwise verify.
 func VerifySignature(pub *ecdsa.PublicKey, payload []byte, rHex, sHex string) bool {
 	h := sha256.Sum256(payload)
 	r := new(big.Int)
@@ -78,5 +103,8 @@ func VerifySignature(pub *ecdsa.PublicKey, payload []byte, rHex, sHex string) bo
 	if !rOk || !sOk {
 		return false
 	}
+	if CheckCanonical(pub.Curve, r, s) != nil {
+		return false
+	}
 	return ecdsa.Verify(pub, h[:], r, s)
 }
@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"errors"
+	"strings"
+)
+
+// Key type names, as stored in wallets.key_type.
+const (
+	KeyTypeP256      = "ECDSA_P256"
+	KeyTypeSecp256k1 = "ECDSA_SECP256K1"
+	KeyTypeEd25519   = "ED25519"
+)
+
+var (
+	ErrUnknownKeyType   = errors.New("unsupported key type")
+	ErrInvalidPublicKey = errors.New("invalid public key encoding")
+	ErrInvalidKey       = errors.New("invalid private key")
+)
+
+// PublicKey is a wallet public key of any supported type. Signatures are
+// always carried as two 64-character hex halves, r and s, whatever the
+// algorithm, so they fit the same transaction columns.
+type PublicKey interface {
+	KeyType() string
+	// Hex is the canonical encoding; wallet IDs are its SHA-256 hash.
+	Hex() string
+	// ParseSignature accepts a signature as sent by a client, either a single
+	// hex string or separate r and s hex, and returns canonical r and s hex.
+	ParseSignature(sigHex, rHex, sHex string) (string, string, error)
+	// Verify checks canonical r and s hex against payload.
+	Verify(payload []byte, rHex, sHex string) bool
+}
+
+// PrivateKey is a wallet signing key of any supported type.
+type PrivateKey interface {
+	Public() PublicKey
+	// Bytes is the 32-byte secret stored in wallet envelopes and keystores.
+	Bytes() []byte
+	Sign(payload []byte) (string, string, error)
+}
+
+// KeyType creates and parses keys of one signature algorithm.
+type KeyType interface {
+	Name() string
+	Generate() (PrivateKey, error)
+	PrivateKeyFromBytes(b []byte) (PrivateKey, error)
+	ParsePublicKey(hexStr string) (PublicKey, error)
+}
+
+var keyTypes = map[string]KeyType{
+	KeyTypeP256:      p256Type{},
+	KeyTypeSecp256k1: secp256k1Type{},
+	KeyTypeEd25519:   ed25519Type{},
+}
+
+// KeyTypes lists the supported key type names.
+func KeyTypes() []string {
+	return []string{KeyTypeP256, KeyTypeSecp256k1, KeyTypeEd25519}
+}
+
+// LookupKeyType returns the implementation for name, case-insensitively.
+// An empty name is P-256, the only type older wallets were created with.
+func LookupKeyType(name string) (KeyType, error) {
+	if name == "" {
+		name = KeyTypeP256
+	}
+	kt, ok := keyTypes[strings.ToUpper(name)]
+	if !ok {
+		return nil, ErrUnknownKeyType
+	}
+	return kt, nil
+}
+
+// ParsePublicKey decodes a hex public key of the given type.
+func ParsePublicKey(keyType, hexStr string) (PublicKey, error) {
+	kt, err := LookupKeyType(keyType)
+	if err != nil {
+		return nil, err
+	}
+	return kt.ParsePublicKey(hexStr)
+}
+
+// Verify checks a client signature, as accepted by PublicKey.ParseSignature,
+// under a hex public key of the given type.
+func Verify(keyType, pubHex string, payload []byte, sigHex, rHex, sHex string) bool {
+	pub, err := ParsePublicKey(keyType, pubHex)
+	if err != nil {
+		return false
+	}
+	r, s, err := pub.ParseSignature(sigHex, rHex, sHex)
+	if err != nil {
+		return false
+	}
+	return pub.Verify(payload, r, s)
+}
@@ -0,0 +1,63 @@
+package crypto
+
+import "crypto/ecdsa"
+
+// p256Type is ECDSA over NIST P-256 with SHA-256, low-S signatures and
+// uncompressed public keys.
+type p256Type struct{}
+
+func (p256Type) Name() string { return KeyTypeP256 }
+
+func (p256Type) Generate() (PrivateKey, error) {
+	priv, _, err := GenerateKeypair()
+	if err != nil {
+		return nil, err
+	}
+	return p256Private{priv}, nil
+}
+
+func (p256Type) PrivateKeyFromBytes(b []byte) (PrivateKey, error) {
+	priv, err := PrivateKeyFromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return p256Private{priv}, nil
+}
+
+func (p256Type) ParsePublicKey(hexStr string) (PublicKey, error) {
+	pub, err := DeserializePublicKey(hexStr)
+	if err != nil {
+		return nil, err
+	}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, ErrInvalidPublicKey
+	}
+	return p256Public{pub}, nil
+}
+
+// FromECDSA wraps a P-256 key, such as one derived from an HD seed.
+func FromECDSA(priv *ecdsa.PrivateKey) PrivateKey { return p256Private{priv} }
+
+type p256Public struct{ pub *ecdsa.PublicKey }
+
+func (p256Public) KeyType() string { return KeyTypeP256 }
+
+func (k p256Public) Hex() string { return SerializePublicKey(k.pub) }
+
+func (k p256Public) ParseSignature(sigHex, rHex, sHex string) (string, string, error) {
+	return ParseSignatureInput(k.pub.Curve, sigHex, rHex, sHex)
+}
+
+func (k p256Public) Verify(payload []byte, rHex, sHex string) bool {
+	return VerifySignature(k.pub, payload, rHex, sHex)
+}
+
+type p256Private struct{ priv *ecdsa.PrivateKey }
+
+func (k p256Private) Public() PublicKey { return p256Public{&k.priv.PublicKey} }
+
+func (k p256Private) Bytes() []byte { return PrivateKeyBytes(k.priv) }
+
+func (k p256Private) Sign(payload []byte) (string, string, error) {
+	return SignPayload(k.priv, payload)
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// secp256k1Type is ECDSA over secp256k1 with SHA-256. Signing is
+// deterministic (RFC 6979); signatures and public keys follow the same
+// canonical rules as P-256: low-S, uncompressed 65-byte keys.
+type secp256k1Type struct{}
+
+func (secp256k1Type) Name() string { return KeyTypeSecp256k1 }
+
+func (secp256k1Type) Generate() (PrivateKey, error) {
+	priv, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1Private{priv}, nil
+}
+
+func (secp256k1Type) PrivateKeyFromBytes(b []byte) (PrivateKey, error) {
+	var d secp256k1.ModNScalar
+	if len(b) != 32 || d.SetByteSlice(b) || d.IsZero() {
+		return nil, ErrInvalidKey
+	}
+	return secp256k1Private{secp256k1.NewPrivateKey(&d)}, nil
+}
+
+func (secp256k1Type) ParsePublicKey(hexStr string) (PublicKey, error) {
+	b, err := hex.DecodeString(hexStr)
+	if err != nil || len(b) != 65 || b[0] != 0x04 {
+		return nil, ErrInvalidPublicKey
+	}
+	pub, err := secp256k1.ParsePubKey(b)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return secp256k1Public{pub}, nil
+}
+
+type secp256k1Public struct{ pub *secp256k1.PublicKey }
+
+func (secp256k1Public) KeyType() string { return KeyTypeSecp256k1 }
+
+func (k secp256k1Public) Hex() string { return hex.EncodeToString(k.pub.SerializeUncompressed()) }
+
+func (secp256k1Public) ParseSignature(sigHex, rHex, sHex string) (string, string, error) {
+	return ParseSignatureInput(secp256k1.S256(), sigHex, rHex, sHex)
+}
+
+// Verify rejects high-S signatures even if they would otherwise verify.
+func (k secp256k1Public) Verify(payload []byte, rHex, sHex string) bool {
+	r, rOk := new(big.Int).SetString(rHex, 16)
+	s, sOk := new(big.Int).SetString(sHex, 16)
+	if !rOk || !sOk || CheckCanonical(secp256k1.S256(), r, s) != nil {
+		return false
+	}
+	var rs, ss secp256k1.ModNScalar
+	rs.SetByteSlice(r.Bytes())
+	ss.SetByteSlice(s.Bytes())
+	h := sha256.Sum256(payload)
+	return secpecdsa.NewSignature(&rs, &ss).Verify(h[:], k.pub)
+}
+
+type secp256k1Private struct{ priv *secp256k1.PrivateKey }
+
+func (k secp256k1Private) Public() PublicKey { return secp256k1Public{k.priv.PubKey()} }
+
+func (k secp256k1Private) Bytes() []byte { return k.priv.Serialize() }
+
+// Sign returns r and s as fixed-width hex; the library already produces low-S.
+func (k secp256k1Private) Sign(payload []byte) (string, string, error) {
+	h := sha256.Sum256(payload)
+	sig := secpecdsa.Sign(k.priv, h[:])
+	r, s := sig.R(), sig.S()
+	rb, sb := r.Bytes(), s.Bytes()
+	return hex.EncodeToString(rb[:]), hex.EncodeToString(sb[:]), nil
+}
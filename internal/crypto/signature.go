@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"regexp"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+var (
+	ErrNonCanonicalSignature = errors.New("non-canonical signature encoding")
+	ErrHighS                 = errors.New("signature s is not low-S normalized")
+)
+
+// scalarHex matches a fixed-width, lower-case 32-byte scalar.
+var scalarHex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// IsLowS reports whether s is in the lower half of the curve order. Only
+// low-S signatures are accepted, which removes (r, n-s) malleability.
+func IsLowS(curve elliptic.Curve, s *big.Int) bool {
+	halfN := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Sign() > 0 && s.Cmp(halfN) <= 0
+}
+
+// NormalizeLowS returns n-s when s is in the upper half of the curve order.
+// Both values verify, so this is a lossless rewrite of a valid signature.
+func NormalizeLowS(curve elliptic.Curve, s *big.Int) *big.Int {
+	if IsLowS(curve, s) {
+		return s
+	}
+	return new(big.Int).Sub(curve.Params().N, s)
+}
+
+// Curve returns the curve of an ECDSA key type, or nil for key types whose
+// signatures have no S to normalize.
+func Curve(keyType string) elliptic.Curve {
+	kt, err := LookupKeyType(keyType)
+	if err != nil {
+		return nil
+	}
+	switch kt.Name() {
+	case KeyTypeP256:
+		return elliptic.P256()
+	case KeyTypeSecp256k1:
+		return secp256k1.S256()
+	}
+	return nil
+}
+
+// ScalarHex encodes a signature component as 64 lower-case hex characters.
+func ScalarHex(v *big.Int) string {
+	return hex.EncodeToString(v.FillBytes(make([]byte, 32)))
+}
+
+// EncodeCompact returns the fixed-width 64-byte r||s encoding.
+func EncodeCompact(r, s *big.Int) []byte {
+	out := make([]byte, 64)
+	r.FillBytes(out[:32])
+	s.FillBytes(out[32:])
+	return out
+}
+
+// DecodeCompact parses a 64-byte r||s signature.
+func DecodeCompact(b []byte) (*big.Int, *big.Int, error) {
+	if len(b) != 64 {
+		return nil, nil, ErrNonCanonicalSignature
+	}
+	return new(big.Int).SetBytes(b[:32]), new(big.Int).SetBytes(b[32:]), nil
+}
+
+// EncodeDER returns the ASN.1 DER SEQUENCE { INTEGER r, INTEGER s }.
+func EncodeDER(r, s *big.Int) []byte {
+	ri, si := derInt(r), derInt(s)
+	body := append(ri, si...)
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+func derInt(v *big.Int) []byte {
+	b := v.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return append([]byte{0x02, byte(len(b))}, b...)
+}
+
+// DecodeDER parses a strictly DER-encoded signature: short-form lengths,
+// positive minimally-encoded integers and no trailing bytes.
+func DecodeDER(b []byte) (*big.Int, *big.Int, error) {
+	// 0x30 len 0x02 rlen r 0x02 slen s; each integer at most 33 bytes
+	if len(b) < 8 || len(b) > 72 || b[0] != 0x30 || int(b[1]) != len(b)-2 {
+		return nil, nil, ErrNonCanonicalSignature
+	}
+	r, rest, err := parseDERInt(b[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	s, rest, err := parseDERInt(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, ErrNonCanonicalSignature
+	}
+	return r, s, nil
+}
+
+func parseDERInt(b []byte) (*big.Int, []byte, error) {
+	if len(b) < 3 || b[0] != 0x02 {
+		return nil, nil, ErrNonCanonicalSignature
+	}
+	n := int(b[1])
+	if n == 0 || n > 33 || len(b) < 2+n {
+		return nil, nil, ErrNonCanonicalSignature
+	}
+	v := b[2 : 2+n]
+	if v[0]&0x80 != 0 {
+		return nil, nil, ErrNonCanonicalSignature // negative
+	}
+	if n > 1 && v[0] == 0 && v[1]&0x80 == 0 {
+		return nil, nil, ErrNonCanonicalSignature // superfluous leading zero
+	}
+	return new(big.Int).SetBytes(v), b[2+n:], nil
+}
+
+// CheckCanonical verifies that r and s are in range and s is low-S.
+func CheckCanonical(curve elliptic.Curve, r, s *big.Int) error {
+	n := curve.Params().N
+	if r.Sign() <= 0 || r.Cmp(n) >= 0 || s.Sign() <= 0 || s.Cmp(n) >= 0 {
+		return ErrNonCanonicalSignature
+	}
+	if !IsLowS(curve, s) {
+		return ErrHighS
+	}
+	return nil
+}
+
+// ParseSignatureInput accepts a signature as sent by a client, either a single
+// hex string (64-byte compact or DER) or separate fixed-width r and s hex, and
+// returns canonical r and s hex. Anything non-canonical is rejected.
+func ParseSignatureInput(curve elliptic.Curve, sigHex, rHex, sHex string) (string, string, error) {
+	var r, s *big.Int
+	switch {
+	case sigHex != "":
+		raw, err := hex.DecodeString(sigHex)
+		if err != nil || hex.EncodeToString(raw) != sigHex {
+			return "", "", ErrNonCanonicalSignature
+		}
+		if len(raw) == 64 {
+			r, s, err = DecodeCompact(raw)
+		} else {
+			r, s, err = DecodeDER(raw)
+		}
+		if err != nil {
+			return "", "", err
+		}
+	case scalarHex.MatchString(rHex) && scalarHex.MatchString(sHex):
+		r, _ = new(big.Int).SetString(rHex, 16)
+		s, _ = new(big.Int).SetString(sHex, 16)
+	default:
+		return "", "", ErrNonCanonicalSignature
+	}
+	if err := CheckCanonical(curve, r, s); err != nil {
+		return "", "", err
+	}
+	return ScalarHex(r), ScalarHex(s), nil
+}
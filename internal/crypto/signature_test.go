@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDER(t *testing.T) {
+	tests := []struct {
+		name string
+		der  string
+		r, s int64
+		err  error
+	}{
+		{"minimal", "3006020101020101", 1, 1, nil},
+		{"high bit padded", "300702020080020101", 0x80, 1, nil},
+		{"two-byte integers", "30080202010002020100", 0x100, 0x100, nil},
+		{"negative r", "3006020180020101", 0, 0, ErrNonCanonicalSignature},
+		{"negative s", "30060201010201ff", 0, 0, ErrNonCanonicalSignature},
+		{"superfluous zero", "30070202000102 0101", 0, 0, ErrNonCanonicalSignature},
+		{"zero-length integer", "3005020002 0101", 0, 0, ErrNonCanonicalSignature},
+		{"long-form sequence length", "308106020101020101", 0, 0, ErrNonCanonicalSignature},
+		{"long-form integer length", "30070281010102 0101", 0, 0, ErrNonCanonicalSignature},
+		{"sequence length too long", "3007020101020101", 0, 0, ErrNonCanonicalSignature},
+		{"sequence length too short", "3005020101020101", 0, 0, ErrNonCanonicalSignature},
+		{"trailing byte", "300602010102010100", 0, 0, ErrNonCanonicalSignature},
+		{"third integer", "3009020101020101020101", 0, 0, ErrNonCanonicalSignature},
+		{"integer runs past end", "3006020101020201", 0, 0, ErrNonCanonicalSignature},
+		{"not a sequence", "3106020101020101", 0, 0, ErrNonCanonicalSignature},
+		{"not an integer", "3006030101020101", 0, 0, ErrNonCanonicalSignature},
+		{"empty", "", 0, 0, ErrNonCanonicalSignature},
+	}
+	for _, tc := range tests {
+		raw, err := hex.DecodeString(strings.ReplaceAll(tc.der, " ", ""))
+		if err != nil {
+			t.Fatalf("%s: bad test hex: %v", tc.name, err)
+		}
+		r, s, err := DecodeDER(raw)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: DecodeDER(%s) error = %v, want %v", tc.name, tc.der, err, tc.err)
+			continue
+		}
+		if err == nil && (r.Int64() != tc.r || s.Int64() != tc.s) {
+			t.Errorf("%s: DecodeDER(%s) = %v, %v; want %d, %d", tc.name, tc.der, r, s, tc.r, tc.s)
+		}
+	}
+}
+
+func TestSignatureEncodingRoundTrip(t *testing.T) {
+	n := elliptic.P256().Params().N
+	values := []*big.Int{
+		big.NewInt(1),
+		big.NewInt(0x7f),
+		big.NewInt(0x80),
+		big.NewInt(0xff00),
+		new(big.Int).Rsh(n, 1),
+		new(big.Int).Sub(n, big.NewInt(1)),
+	}
+	for _, r := range values {
+		for _, s := range values {
+			der := EncodeDER(r, s)
+			dr, ds, err := DecodeDER(der)
+			if err != nil || dr.Cmp(r) != 0 || ds.Cmp(s) != 0 {
+				t.Errorf("DER round trip of (%x, %x) via %x = (%v, %v), %v", r, s, der, dr, ds, err)
+			}
+			compact := EncodeCompact(r, s)
+			cr, cs, err := DecodeCompact(compact)
+			if err != nil || cr.Cmp(r) != 0 || cs.Cmp(s) != 0 {
+				t.Errorf("compact round trip of (%x, %x) = (%v, %v), %v", r, s, cr, cs, err)
+			}
+		}
+	}
+
+	for _, size := range []int{0, 63, 65} {
+		if _, _, err := DecodeCompact(make([]byte, size)); !errors.Is(err, ErrNonCanonicalSignature) {
+			t.Errorf("DecodeCompact of %d bytes = %v, want %v", size, err, ErrNonCanonicalSignature)
+		}
+	}
+}
+
+func TestParseSignatureInput(t *testing.T) {
+	curve := elliptic.P256()
+	n := curve.Params().N
+	r := big.NewInt(0xabcd)
+	low := big.NewInt(0x80)
+	high := new(big.Int).Sub(n, low)
+
+	want := [2]string{ScalarHex(r), ScalarHex(low)}
+	tests := []struct {
+		name       string
+		sig, rx, s string
+		err        error
+	}{
+		{"separate halves", "", ScalarHex(r), ScalarHex(low), nil},
+		{"compact", hex.EncodeToString(EncodeCompact(r, low)), "", "", nil},
+		{"DER", hex.EncodeToString(EncodeDER(r, low)), "", "", nil},
+		{"high S", hex.EncodeToString(EncodeDER(r, high)), "", "", ErrHighS},
+		{"high S halves", "", ScalarHex(r), ScalarHex(high), ErrHighS},
+		{"zero r", hex.EncodeToString(EncodeCompact(big.NewInt(0), low)), "", "", ErrNonCanonicalSignature},
+		{"r equal to n", hex.EncodeToString(EncodeCompact(n, low)), "", "", ErrNonCanonicalSignature},
+		{"uppercase hex", strings.ToUpper(hex.EncodeToString(EncodeDER(r, low))), "", "", ErrNonCanonicalSignature},
+		{"short halves", "", ScalarHex(r)[2:], ScalarHex(low), ErrNonCanonicalSignature},
+		{"uppercase halves", "", strings.ToUpper(ScalarHex(r)), ScalarHex(low), ErrNonCanonicalSignature},
+		{"nothing", "", "", "", ErrNonCanonicalSignature},
+	}
+	for _, tc := range tests {
+		gr, gs, err := ParseSignatureInput(curve, tc.sig, tc.rx, tc.s)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if err == nil && [2]string{gr, gs} != want {
+			t.Errorf("%s: got (%s, %s), want %v", tc.name, gr, gs, want)
+		}
+	}
+}
+
+func TestNormalizeLowS(t *testing.T) {
+	curve := elliptic.P256()
+	n := curve.Params().N
+	half := new(big.Int).Rsh(n, 1)
+	above := new(big.Int).Add(half, big.NewInt(1))
+	if got := NormalizeLowS(curve, half); got.Cmp(half) != 0 {
+		t.Errorf("NormalizeLowS(n/2) = %x, want unchanged", got)
+	}
+	if got := NormalizeLowS(curve, above); !IsLowS(curve, got) || new(big.Int).Add(got, above).Cmp(n) != 0 {
+		t.Errorf("NormalizeLowS(n/2+1) = %x, want n-s", got)
+	}
+	if !bytes.Equal(EncodeCompact(half, half)[32:], half.FillBytes(make([]byte, 32))) {
+		t.Error("EncodeCompact does not left-pad s")
+	}
+}
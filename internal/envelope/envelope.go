@@ -0,0 +1,233 @@
+// Package envelope encrypts custodial wallet keys with envelope encryption.
+//
+// Each wallet key is encrypted with its own random 256-bit data key (DEK).
+// The DEK is then wrapped, also with AES-256-GCM, by a key-encryption key
+// that is either derived from the user's passphrase with Argon2id or is a
+// server master key held by the key manager (see internal/kms). The stored
+// value is the JSON Envelope, so the database alone is never enough to
+// recover a key.
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/keystore"
+)
+
+const Version = 1
+
+const (
+	WrapPassphrase = "passphrase"
+	WrapMaster     = "master"
+)
+
+const MinPassphraseLen = 8
+
+var (
+	ErrNoMasterKey     = errors.New("no master key is configured")
+	ErrWrongMasterKey  = errors.New("wallet key was wrapped with a different master key")
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrPassphrase      = fmt.Errorf("passphrase must be at least %d characters", MinPassphraseLen)
+	ErrNotEnvelope     = errors.New("value is not an encrypted envelope")
+)
+
+type Envelope struct {
+	Version    int                 `json:"v"`
+	Wrap       string              `json:"wrap"`                 // passphrase | master
+	KDF        *keystore.KDFParams `json:"kdf,omitempty"`        // passphrase wrap only
+	MasterKey  string              `json:"master_key,omitempty"` // master key ID, master wrap only
+	WrappedKey string              `json:"wrapped_key"`          // DEK encrypted under the KEK
+	Ciphertext string              `json:"ciphertext"`           // plaintext encrypted under the DEK
+}
+
+// KeyWrapper wraps data keys under a server master key that never leaves it.
+// kms.KeyManager implements it.
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, dek []byte) (keyID, wrapped string, err error)
+	UnwrapKey(ctx context.Context, keyID, wrapped string) ([]byte, error)
+}
+
+// master wraps and unwraps master-wrapped envelopes; set by kms.Init.
+var master KeyWrapper
+
+// UseKeyWrapper sets the wrapper for master-wrapped envelopes. Until one is
+// set, master wrapping fails with ErrNoMasterKey.
+func UseKeyWrapper(w KeyWrapper) { master = w }
+
+// IsEnvelope reports whether a stored private_key_enc value is an envelope
+// rather than a legacy ciphertext.
+func IsEnvelope(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "{")
+}
+
+// wrapFunc wraps dek into env, recording how it was wrapped.
+type wrapFunc func(env *Envelope, dek []byte) error
+
+// withPassphrase wraps under an Argon2id key derived from passphrase.
+func withPassphrase(passphrase string) wrapFunc {
+	return func(env *Envelope, dek []byte) error {
+		if len(passphrase) < MinPassphraseLen {
+			return ErrPassphrase
+		}
+		kdf := keystore.DefaultArgon2id()
+		kek, err := kdf.Derive(passphrase, 32)
+		if err != nil {
+			return err
+		}
+		if env.WrappedKey, err = crypto.EncryptBytesAESGCM(kek, dek); err != nil {
+			return err
+		}
+		env.Wrap, env.KDF, env.MasterKey = WrapPassphrase, &kdf, ""
+		return nil
+	}
+}
+
+// withMaster wraps under the key manager's current master key.
+func withMaster(env *Envelope, dek []byte) error {
+	if master == nil {
+		return ErrNoMasterKey
+	}
+	keyID, wrapped, err := master.WrapKey(context.Background(), dek)
+	if err != nil {
+		return err
+	}
+	env.Wrap, env.KDF, env.MasterKey, env.WrappedKey = WrapMaster, nil, keyID, wrapped
+	return nil
+}
+
+func seal(plaintext []byte, wrap wrapFunc) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	ct, err := crypto.EncryptBytesAESGCM(dek, plaintext)
+	if err != nil {
+		return "", err
+	}
+	env := Envelope{Version: Version, Ciphertext: ct}
+	if err := wrap(&env, dek); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(env)
+	return string(raw), err
+}
+
+// SealWithPassphrase encrypts plaintext under a fresh DEK wrapped by an
+// Argon2id key derived from passphrase.
+func SealWithPassphrase(plaintext []byte, passphrase string) (string, error) {
+	return seal(plaintext, withPassphrase(passphrase))
+}
+
+// SealWithMaster encrypts plaintext under a fresh DEK wrapped by the server master key.
+func SealWithMaster(plaintext []byte) (string, error) {
+	return seal(plaintext, withMaster)
+}
+
+// Seal wraps with the passphrase when one is given, otherwise with the master key.
+func Seal(plaintext []byte, passphrase string) (string, error) {
+	if passphrase != "" {
+		return SealWithPassphrase(plaintext, passphrase)
+	}
+	return SealWithMaster(plaintext)
+}
+
+// Parse decodes a stored envelope.
+func Parse(s string) (*Envelope, error) {
+	if !IsEnvelope(s) {
+		return nil, ErrNotEnvelope
+	}
+	var env Envelope
+	if err := json.Unmarshal([]byte(s), &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotEnvelope, err)
+	}
+	if env.Version != Version {
+		return nil, fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+	return &env, nil
+}
+
+// unwrap recovers the DEK, using w for master-wrapped envelopes.
+// passphrase is ignored for master-wrapped envelopes.
+func (env *Envelope) unwrap(passphrase string, w KeyWrapper) ([]byte, error) {
+	switch env.Wrap {
+	case WrapPassphrase:
+		if env.KDF == nil {
+			return nil, errors.New("envelope is missing its kdf parameters")
+		}
+		kek, err := env.KDF.Derive(passphrase, 32)
+		if err != nil {
+			return nil, err
+		}
+		dek, err := crypto.DecryptBytesAESGCM(kek, env.WrappedKey)
+		if err != nil {
+			return nil, ErrWrongPassphrase
+		}
+		return dek, nil
+	case WrapMaster:
+		if w == nil {
+			return nil, ErrNoMasterKey
+		}
+		return w.UnwrapKey(context.Background(), env.MasterKey, env.WrappedKey)
+	default:
+		return nil, fmt.Errorf("unknown wrap %q", env.Wrap)
+	}
+}
+
+// Open decrypts a stored envelope. passphrase is only needed for
+// passphrase-wrapped envelopes.
+func Open(s, passphrase string) ([]byte, error) {
+	return OpenWith(s, passphrase, master)
+}
+
+// OpenWith is Open with master-wrapped data keys unwrapped by w.
+func OpenWith(s, passphrase string, w KeyWrapper) ([]byte, error) {
+	env, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := env.unwrap(passphrase, w)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecryptBytesAESGCM(dek, env.Ciphertext)
+}
+
+// Rewrap re-encrypts only the DEK, e.g. for a passphrase change or to move a
+// wallet between passphrase and master wrapping. An empty newPassphrase wraps
+// with the current master key, which also moves a master-wrapped envelope
+// onto a rotated key.
+func Rewrap(s, oldPassphrase, newPassphrase string) (string, error) {
+	env, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	dek, err := env.unwrap(oldPassphrase, master)
+	if err != nil {
+		return "", err
+	}
+
+	next := Envelope{Version: Version, Ciphertext: env.Ciphertext}
+	wrap := withMaster
+	if newPassphrase != "" {
+		wrap = withPassphrase(newPassphrase)
+	}
+	if err := wrap(&next, dek); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(next)
+	return string(raw), err
+}
+
+// OpenLegacy decrypts a value written before envelopes, when wallets were
+// encrypted with the owner's user ID copied into a 32-byte AES key.
+func OpenLegacy(ciphertext, userID string) ([]byte, error) {
+	key := make([]byte, 32)
+	copy(key, []byte(userID))
+	return crypto.DecryptBytesAESGCM(key, ciphertext)
+}
@@ -6,6 +6,9 @@ import (
 	"net/http"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
 )
 
 var dbPool *pgxpool.Pool
@@ -13,24 +16,26 @@ var dbPool *pgxpool.Pool
 func Init(pool *pgxpool.Pool) { dbPool = pool }
 
 func WalletInfoHandler(w http.ResponseWriter, r *http.Request) {
-	walletID := r.URL.Query().Get("wallet_id")
+	walletID, err := address.FromQuery(r, "wallet_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if walletID == "" {
 		http.Error(w, "wallet_id required", http.StatusBadRequest)
 		return
 	}
 
-	var pubKey string
-	err := dbPool.QueryRow(context.Background(),
-		`SELECT public_key FROM wallets WHERE wallet_id=$1`, walletID).Scan(&pubKey)
+	var pubKey, keyType string
+	err = dbPool.QueryRow(context.Background(),
+		`SELECT public_key, key_type FROM wallets WHERE wallet_id=$1`, walletID).Scan(&pubKey, &keyType)
 	if err != nil {
 		http.Error(w, "wallet not found", http.StatusNotFound)
 		return
 	}
 
-	var balance int64
-	err = dbPool.QueryRow(context.Background(),
-		`SELECT COALESCE(SUM(amount),0) FROM utxos WHERE wallet_id=$1 AND spent=false`, walletID).
-		Scan(&balance)
+	// balance stays the total of unspent outputs; the rest break it down
+	b, err := wallet.WalletBalance(context.Background(), dbPool, walletID)
 	if err != nil {
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
@@ -38,14 +43,24 @@ func WalletInfoHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"wallet_id":  walletID,
-		"public_key": pubKey,
-		"balance":    balance,
+		"wallet_id":            walletID,
+		"address":              address.For(walletID),
+		"public_key":           pubKey,
+		"key_type":             keyType,
+		"balance":              b.Total,
+		"confirmed":            b.Confirmed,
+		"unconfirmed_incoming": b.UnconfirmedIncoming,
+		"unconfirmed_outgoing": b.UnconfirmedOutgoing,
+		"locked":               b.Locked,
 	})
 }
 
 func WalletUtxosHandler(w http.ResponseWriter, r *http.Request) {
-	walletID := r.URL.Query().Get("wallet_id")
+	walletID, err := address.FromQuery(r, "wallet_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if walletID == "" {
 		http.Error(w, "wallet_id required", http.StatusBadRequest)
 		return
@@ -77,6 +92,7 @@ func WalletUtxosHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"wallet_id": walletID,
+		"address":   address.For(walletID),
 		"utxos":     list,
 	})
 }
@@ -90,10 +106,14 @@ func TxDetailHandler(w http.ResponseWriter, r *http.Request) {
 
 	var from, to, status string
 	var amount, fee int64
+	var confirmations int
 	err := dbPool.QueryRow(context.Background(),
-		`SELECT from_wallet_id, to_wallet_id, amount, fee, status
-         FROM transactions WHERE tx_id=$1::uuid`, txID).
-		Scan(&from, &to, &amount, &fee, &status)
+		`SELECT t.from_wallet_id, t.to_wallet_id, t.amount, t.fee, t.status,
+                COALESCE((SELECT MAX(height) FROM blocks) - b.height + 1, 0)
+         FROM transactions t
+         LEFT JOIN blocks b ON b.block_id = t.block_id
+         WHERE t.tx_id=$1::uuid`, txID).
+		Scan(&from, &to, &amount, &fee, &status, &confirmations)
 	if err != nil {
 		http.Error(w, "transaction not found", http.StatusNotFound)
 		return
@@ -134,6 +154,7 @@ func TxDetailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	type Out struct {
 		WalletID string `json:"wallet_id"`
+		Address  string `json:"address"`
 		Amount   int64  `json:"amount"`
 		Index    int    `json:"index"`
 	}
@@ -144,20 +165,24 @@ func TxDetailHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "db scan error", http.StatusInternalServerError)
 			return
 		}
+		o.Address = address.For(o.WalletID)
 		outputs = append(outputs, o)
 	}
 	outRows.Close()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"tx_id":   txID,
-		"from":    from,
-		"to":      to,
-		"amount":  amount,
-		"fee":     fee,
-		"status":  status,
-		"inputs":  inputs,
-		"outputs": outputs,
+		"tx_id":         txID,
+		"from":          from,
+		"from_address":  address.For(from),
+		"to":            to,
+		"to_address":    address.For(to),
+		"amount":        amount,
+		"fee":           fee,
+		"status":        status,
+		"confirmations": confirmations,
+		"inputs":        inputs,
+		"outputs":       outputs,
 	})
 }
 
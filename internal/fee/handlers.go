@@ -0,0 +1,95 @@
+package fee
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/mempool"
+)
+
+// ✅ Get the fee policy in force
+func PolicyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Current())
+}
+
+// policyFields are the keys a replacement policy must carry; a missing one
+// would otherwise silently become zero.
+var policyFields = []string{
+	"min_relay_fee", "fee_per_byte", "amount_bps", "amount_cap",
+	"max_fee", "dust_limit", "tier_discount_bps",
+}
+
+// ✅ Replace the fee policy (operators only). The body is the whole policy:
+// every field is required and tiers left out of tier_discount_bps are removed.
+func UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !auth.IsAdmin(claims) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	email, _ := claims["email"].(string)
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	for _, f := range policyFields {
+		if _, ok := doc[f]; !ok {
+			http.Error(w, "missing field "+f, http.StatusBadRequest)
+			return
+		}
+	}
+	raw, _ := json.Marshal(doc)
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := Set(context.Background(), p, email); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// ✅ Estimate the required fee for an amount, input count and wallet tier
+func EstimateHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	amount, err := strconv.ParseInt(q.Get("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		http.Error(w, "amount required", http.StatusBadRequest)
+		return
+	}
+	inputs, _ := strconv.Atoi(q.Get("inputs"))
+	if inputs <= 0 {
+		inputs = 1
+	}
+	tier := q.Get("tier")
+	if tier == "" {
+		tier = "standard"
+	}
+
+	size := mempool.EstimateSize(inputs, 2)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"amount":       amount,
+		"inputs":       inputs,
+		"tier":         tier,
+		"size":         size,
+		"required_fee": Current().Required(Params{Size: size, Amount: amount, Tier: tier}),
+	})
+}
@@ -0,0 +1,180 @@
+package fee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var dbPool *pgxpool.Pool
+
+var (
+	ErrTooLow  = errors.New("fee below policy minimum")
+	ErrTooHigh = errors.New("fee above policy maximum")
+)
+
+// Policy decides the fee a transaction must pay. The required fee is
+//
+//	max(MinRelayFee, FeePerByte*size + min(amount*AmountBps/10000, AmountCap))
+//
+// reduced by the sender wallet's tier discount. System transactions pay nothing.
+type Policy struct {
+	MinRelayFee     int64            `json:"min_relay_fee"`     // floor for any non-system transaction
+	FeePerByte      int64            `json:"fee_per_byte"`      // charged on the estimated size
+	AmountBps       int64            `json:"amount_bps"`        // proportional part, in basis points of amount
+	AmountCap       int64            `json:"amount_cap"`        // cap on the proportional part; 0 = uncapped
+	MaxFee          int64            `json:"max_fee"`           // largest fee a client may offer; 0 = unlimited
+	DustLimit       int64            `json:"dust_limit"`        // change below this is folded into the fee
+	TierDiscountBps map[string]int64 `json:"tier_discount_bps"` // wallet tier → discount in basis points
+}
+
+// DefaultPolicy reproduces the original "1% capped at 1000" fee.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinRelayFee: 1,
+		FeePerByte:  0,
+		AmountBps:   100,
+		AmountCap:   1000,
+		MaxFee:      100000,
+		DustLimit:   100,
+		TierDiscountBps: map[string]int64{
+			"standard": 0,
+			"premium":  2500,
+			"business": 5000,
+		},
+	}
+}
+
+// Params describes the transaction a fee is computed for.
+type Params struct {
+	Size   int   // estimated bytes, see mempool.EstimateSize
+	Amount int64 // amount sent to the recipient
+	Tier   string
+	System bool // zakat and other server-originated transactions
+}
+
+func (p Policy) Validate() error {
+	if p.MinRelayFee < 0 || p.FeePerByte < 0 || p.AmountBps < 0 || p.AmountCap < 0 || p.MaxFee < 0 || p.DustLimit < 0 {
+		return errors.New("fee policy values must not be negative")
+	}
+	if p.AmountBps > 10000 {
+		return errors.New("amount_bps must not exceed 10000")
+	}
+	for tier, d := range p.TierDiscountBps {
+		if d < 0 || d > 10000 {
+			return fmt.Errorf("discount for tier %q must be between 0 and 10000", tier)
+		}
+	}
+	if p.MaxFee > 0 && p.MaxFee < p.MinRelayFee {
+		return errors.New("max_fee must not be below min_relay_fee")
+	}
+	return nil
+}
+
+// Required is the minimum fee for a transaction under this policy.
+func (p Policy) Required(x Params) int64 {
+	if x.System {
+		return 0
+	}
+	prop := bps(x.Amount, p.AmountBps)
+	if p.AmountCap > 0 && prop > p.AmountCap {
+		prop = p.AmountCap
+	}
+	fee := p.FeePerByte*int64(x.Size) + prop
+	if d := p.TierDiscountBps[x.Tier]; d > 0 {
+		fee -= bps(fee, d)
+	}
+	if fee < p.MinRelayFee {
+		fee = p.MinRelayFee
+	}
+	return fee
+}
+
+// bps is v*b/10000 rounded down, without overflowing for any v when b is at
+// most 10000.
+func bps(v, b int64) int64 {
+	return v/10000*b + v%10000*b/10000
+}
+
+// IsDust reports whether an output amount is too small to be worth keeping.
+func (p Policy) IsDust(amount int64) bool {
+	return amount > 0 && amount < p.DustLimit
+}
+
+// Check validates a fee offered for a transaction.
+func (p Policy) Check(offered int64, x Params) error {
+	if x.System {
+		if offered != 0 {
+			return fmt.Errorf("%w: system transactions pay no fee", ErrTooHigh)
+		}
+		return nil
+	}
+	if req := p.Required(x); offered < req {
+		return fmt.Errorf("%w: %d < %d", ErrTooLow, offered, req)
+	}
+	if p.MaxFee > 0 && offered > p.MaxFee {
+		return fmt.Errorf("%w: %d > %d", ErrTooHigh, offered, p.MaxFee)
+	}
+	return nil
+}
+
+var (
+	mu      sync.RWMutex
+	current = DefaultPolicy()
+)
+
+// Current returns a copy of the policy in force.
+func Current() Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	p := current
+	p.TierDiscountBps = make(map[string]int64, len(current.TierDiscountBps))
+	for k, v := range current.TierDiscountBps {
+		p.TierDiscountBps[k] = v
+	}
+	return p
+}
+
+// Init loads the stored policy, falling back to DefaultPolicy.
+func Init(pool *pgxpool.Pool) {
+	dbPool = pool
+	var raw []byte
+	err := dbPool.QueryRow(context.Background(), `SELECT policy FROM fee_policy WHERE id=1`).Scan(&raw)
+	if err != nil {
+		return
+	}
+	p := DefaultPolicy()
+	if err := json.Unmarshal(raw, &p); err != nil || p.Validate() != nil {
+		log.Printf("fee policy in database is invalid, using defaults")
+		return
+	}
+	mu.Lock()
+	current = p
+	mu.Unlock()
+}
+
+// Set validates, persists and activates a new policy.
+func Set(ctx context.Context, p Policy, updatedBy string) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err := dbPool.Exec(ctx,
+		`INSERT INTO fee_policy (id, policy, updated_by, updated_at) VALUES (1,$1,$2,NOW())
+         ON CONFLICT (id) DO UPDATE SET policy=$1, updated_by=$2, updated_at=NOW()`,
+		raw, updatedBy); err != nil {
+		return err
+	}
+	mu.Lock()
+	current = p
+	mu.Unlock()
+	return nil
+}
@@ -0,0 +1,170 @@
+// Package hd derives wallet keys from a BIP-39 mnemonic.
+//
+// Wallet keys are P-256, so derivation follows SLIP-0010 for the nist256p1
+// curve. SLIP-0010 only defines hardened derivation for NIST curves, which
+// suits us: every level of the path is hardened and child public keys are
+// never derived without the seed.
+package hd
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+)
+
+// Hardened is added to an index to make it a hardened child index.
+const Hardened uint32 = 1 << 31
+
+// WalletPath is the derivation path of the index-th wallet of a seed:
+// m/44'/1'/0'/0'/index'.
+func WalletPath(index uint32) []uint32 {
+	return []uint32{44 + Hardened, 1 + Hardened, 0 + Hardened, 0 + Hardened, index + Hardened}
+}
+
+// PathString formats a path as m/44'/1'/...
+func PathString(path []uint32) string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, i := range path {
+		if i >= Hardened {
+			fmt.Fprintf(&b, "/%d'", i-Hardened)
+		} else {
+			fmt.Fprintf(&b, "/%d", i)
+		}
+	}
+	return b.String()
+}
+
+var curveOrder = crypto.CurveP256().Params().N
+
+// Key is an extended private key.
+type Key struct {
+	Key       []byte // 32-byte private scalar
+	ChainCode []byte
+}
+
+// NewMnemonic returns a fresh mnemonic of 12 or 24 words.
+func NewMnemonic(words int) (string, error) {
+	bits := 128
+	switch words {
+	case 0, 12:
+	case 24:
+		bits = 256
+	default:
+		return "", errors.New("mnemonic must be 12 or 24 words")
+	}
+	entropy, err := bip39.NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// NormalizeMnemonic lower-cases a mnemonic and collapses whitespace.
+func NormalizeMnemonic(m string) string {
+	return strings.Join(strings.Fields(strings.ToLower(m)), " ")
+}
+
+// SeedFromMnemonic validates the mnemonic's checksum and returns the 64-byte seed.
+func SeedFromMnemonic(mnemonic string) ([]byte, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(NormalizeMnemonic(mnemonic), "")
+	if err != nil {
+		return nil, errors.New("invalid mnemonic")
+	}
+	return seed, nil
+}
+
+// Master derives the root key of a seed.
+func Master(seed []byte) *Key {
+	mac := hmac.New(sha512.New, []byte("Nist256p1 seed"))
+	mac.Write(seed)
+	I := mac.Sum(nil)
+	// Retry on an invalid key, as SLIP-0010 specifies for nist256p1.
+	for !validScalar(I[:32]) {
+		mac = hmac.New(sha512.New, []byte("Nist256p1 seed"))
+		mac.Write(I)
+		I = mac.Sum(nil)
+	}
+	return &Key{Key: I[:32], ChainCode: I[32:]}
+}
+
+// Child derives a hardened child key.
+func (k *Key) Child(index uint32) (*Key, error) {
+	if index < Hardened {
+		return nil, errors.New("only hardened derivation is supported")
+	}
+	data := make([]byte, 37)
+	copy(data[1:33], k.Key)
+	binary.BigEndian.PutUint32(data[33:], index)
+
+	parent := new(big.Int).SetBytes(k.Key)
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		I := mac.Sum(nil)
+
+		il := new(big.Int).SetBytes(I[:32])
+		child := new(big.Int).Add(il, parent)
+		child.Mod(child, curveOrder)
+		if il.Cmp(curveOrder) < 0 && child.Sign() != 0 {
+			return &Key{Key: child.FillBytes(make([]byte, 32)), ChainCode: I[32:]}, nil
+		}
+		// Invalid child: retry with 0x01 || IR || index.
+		data[0] = 0x01
+		copy(data[1:33], I[32:])
+	}
+}
+
+// Derive walks a path from this key.
+func (k *Key) Derive(path []uint32) (*Key, error) {
+	cur := k
+	for _, i := range path {
+		next, err := cur.Child(i)
+		if err != nil {
+			return nil, err
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// PrivateKey returns the ECDSA private key.
+func (k *Key) PrivateKey() (*ecdsa.PrivateKey, error) {
+	return crypto.PrivateKeyFromBytes(k.Key)
+}
+
+// WalletKey derives the index-th wallet key of a seed.
+func WalletKey(seed []byte, index uint32) (*ecdsa.PrivateKey, error) {
+	k, err := Master(seed).Derive(WalletPath(index))
+	if err != nil {
+		return nil, err
+	}
+	return k.PrivateKey()
+}
+
+// Fingerprint identifies a seed by its root public key, so a recovered
+// mnemonic can be matched to the one on file without storing the seed in clear.
+func Fingerprint(seed []byte) (string, error) {
+	priv, err := Master(seed).PrivateKey()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(crypto.SerializePublicKey(&priv.PublicKey)))
+	return hex.EncodeToString(sum[:4]), nil
+}
+
+func validScalar(b []byte) bool {
+	v := new(big.Int).SetBytes(b)
+	return v.Sign() != 0 && v.Cmp(curveOrder) < 0
+}
@@ -0,0 +1,147 @@
+package hd
+
+import (
+	"crypto/elliptic"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// SLIP-0010 nist256p1 test vectors. Only the hardened paths apply: this
+// package does not derive non-hardened children.
+func TestSLIP10Vectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		seed      string
+		path      []uint32
+		chainCode string
+		private   string
+		public    string
+	}{
+		{
+			name:      "vector 1 m",
+			seed:      "000102030405060708090a0b0c0d0e0f",
+			chainCode: "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			private:   "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2",
+			public:    "0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8",
+		},
+		{
+			name:      "vector 1 m/0H",
+			seed:      "000102030405060708090a0b0c0d0e0f",
+			path:      []uint32{0 + Hardened},
+			chainCode: "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			private:   "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c",
+			public:    "0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c",
+		},
+		{
+			name:      "vector 2 m",
+			seed:      "fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+			chainCode: "96cd4465a9644e31528eda3592aa35eb39a9527769ce1855beafc1b81055e75d",
+			private:   "eaa31c2e46ca2962227cf21d73a7ef0ce8b31c756897521eb6c7b39796633357",
+		},
+		{
+			name:      "derivation retry",
+			seed:      "000102030405060708090a0b0c0d0e0f",
+			path:      []uint32{28578 + Hardened},
+			chainCode: "e94c8ebe30c2250a14713212f6449b20f3329105ea15b652ca5bdfc68f6c65c2",
+			private:   "06f0db126f023755d0b8d86d4591718a5210dd8d024e3e14b6159d63f53aa669",
+		},
+		{
+			name:      "seed retry",
+			seed:      "a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446",
+			chainCode: "7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c",
+			private:   "3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f",
+		},
+	}
+	for _, tc := range tests {
+		k, err := Master(mustHex(t, tc.seed)).Derive(tc.path)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := hex.EncodeToString(k.ChainCode); got != tc.chainCode {
+			t.Errorf("%s: chain code = %s, want %s", tc.name, got, tc.chainCode)
+		}
+		if got := hex.EncodeToString(k.Key); got != tc.private {
+			t.Errorf("%s: private key = %s, want %s", tc.name, got, tc.private)
+		}
+		if tc.public == "" {
+			continue
+		}
+		priv, err := k.PrivateKey()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		pub := elliptic.MarshalCompressed(priv.Curve, priv.X, priv.Y)
+		if got := hex.EncodeToString(pub); got != tc.public {
+			t.Errorf("%s: public key = %s, want %s", tc.name, got, tc.public)
+		}
+	}
+}
+
+func TestChildRejectsNonHardened(t *testing.T) {
+	k := Master(mustHex(t, "000102030405060708090a0b0c0d0e0f"))
+	if _, err := k.Child(1); err == nil {
+		t.Error("Child(1) succeeded, want an error")
+	}
+	if _, err := k.Derive([]uint32{Hardened, 1}); err == nil {
+		t.Error("Derive(m/0'/1) succeeded, want an error")
+	}
+}
+
+// BIP-39 test vector with an empty passphrase.
+func TestSeedFromMnemonic(t *testing.T) {
+	const want = "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	tests := []struct {
+		name     string
+		mnemonic string
+		ok       bool
+	}{
+		{"vector", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", true},
+		{"case and spacing", "  Abandon abandon abandon abandon abandon abandon\tabandon abandon abandon abandon abandon ABOUT\n", true},
+		{"bad checksum", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", false},
+		{"unknown word", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abuot", false},
+		{"too short", "abandon about", false},
+	}
+	for _, tc := range tests {
+		seed, err := SeedFromMnemonic(tc.mnemonic)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: error = %v, want ok=%v", tc.name, err, tc.ok)
+			continue
+		}
+		if tc.ok && hex.EncodeToString(seed) != want {
+			t.Errorf("%s: seed = %x, want %s", tc.name, seed, want)
+		}
+	}
+}
+
+func TestWalletPath(t *testing.T) {
+	if got := PathString(WalletPath(3)); got != "m/44'/1'/0'/0'/3'" {
+		t.Errorf("PathString(WalletPath(3)) = %q", got)
+	}
+	if got := PathString([]uint32{Hardened, 7}); got != "m/0'/7" {
+		t.Errorf("PathString(m/0'/7) = %q", got)
+	}
+
+	seed := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	k, err := Master(seed).Derive(WalletPath(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := WalletKey(seed, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(priv.D.FillBytes(make([]byte, 32))); got != hex.EncodeToString(k.Key) {
+		t.Errorf("WalletKey(seed, 3) = %s, want the key at %s", got, PathString(WalletPath(3)))
+	}
+}
@@ -0,0 +1,229 @@
+package invoice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+type CreateRequest struct {
+	WalletID  string `json:"wallet_id"` // merchant wallet receiving the payment
+	Amount    int64  `json:"amount"`
+	Memo      string `json:"memo"`
+	Reference string `json:"reference"`  // merchant's own order/reference number
+	ExpiresIn int64  `json:"expires_in"` // seconds; default 24h
+}
+
+const defaultExpiry = 24 * time.Hour
+
+// ✅ Create an invoice for one of the user's wallets
+func CreateHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := address.Normalize(&req.WalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.WalletID == "" || req.Amount <= 0 || req.ExpiresIn < 0 {
+		http.Error(w, "missing or invalid fields", http.StatusBadRequest)
+		return
+	}
+	if err := wallet.EnsureWalletOwnedByUser(dbPool, req.WalletID, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	expiry := defaultExpiry
+	if req.ExpiresIn > 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+	}
+	expiresAt := time.Now().Add(expiry).UTC().Truncate(time.Second)
+
+	var invoiceID string
+	err := dbPool.QueryRow(context.Background(),
+		`INSERT INTO invoices (user_id, wallet_id, amount, memo, reference, expires_at)
+         VALUES ($1,$2,$3,$4,$5,$6)
+         RETURNING invoice_id::text`,
+		userID, req.WalletID, req.Amount, req.Memo, req.Reference, expiresAt).Scan(&invoiceID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	p := PaymentRequest{WalletID: req.WalletID, Amount: req.Amount, InvoiceID: invoiceID, Memo: req.Memo, ExpiresAt: expiresAt}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"invoice_id": invoiceID,
+		"wallet_id":  req.WalletID,
+		"address":    address.For(req.WalletID),
+		"amount":     req.Amount,
+		"memo":       req.Memo,
+		"reference":  req.Reference,
+		"status":     "open",
+		"expires_at": expiresAt,
+		"uri":        p.URI(),
+		"qr_payload": p.QRPayload(),
+	})
+}
+
+// ✅ List invoices issued by the authenticated user
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	ctx := context.Background()
+	expireStale(ctx)
+
+	rows, err := dbPool.Query(ctx,
+		`SELECT invoice_id::text, wallet_id, amount, amount_paid, memo, reference, status, expires_at, created_at
+         FROM invoices WHERE user_id=$1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type I struct {
+		InvoiceID  string    `json:"invoice_id"`
+		WalletID   string    `json:"wallet_id"`
+		Address    string    `json:"address"`
+		Amount     int64     `json:"amount"`
+		AmountPaid int64     `json:"amount_paid"`
+		Memo       string    `json:"memo"`
+		Reference  string    `json:"reference"`
+		Status     string    `json:"status"`
+		ExpiresAt  time.Time `json:"expires_at"`
+		CreatedAt  time.Time `json:"created_at"`
+		URI        string    `json:"uri"`
+	}
+	var list []I
+	for rows.Next() {
+		var i I
+		if err := rows.Scan(&i.InvoiceID, &i.WalletID, &i.Amount, &i.AmountPaid, &i.Memo, &i.Reference,
+			&i.Status, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		i.Address = address.For(i.WalletID)
+		i.URI = PaymentRequest{WalletID: i.WalletID, Amount: i.Amount, InvoiceID: i.InvoiceID, Memo: i.Memo, ExpiresAt: i.ExpiresAt}.URI()
+		list = append(list, i)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"invoices": list})
+}
+
+// ✅ Get an invoice with its matched payments (visible to payers too)
+func DetailHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	invoiceID := r.URL.Query().Get("invoice_id")
+	if invoiceID == "" {
+		http.Error(w, "invoice_id required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	expireStale(ctx)
+
+	var walletID, memo, reference, status string
+	var amount, amountPaid int64
+	var expiresAt, created time.Time
+	err := dbPool.QueryRow(ctx,
+		`SELECT wallet_id, amount, amount_paid, memo, reference, status, expires_at, created_at
+         FROM invoices WHERE invoice_id=$1::uuid`, invoiceID).
+		Scan(&walletID, &amount, &amountPaid, &memo, &reference, &status, &expiresAt, &created)
+	if err != nil {
+		http.Error(w, "invoice not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := dbPool.Query(ctx,
+		`SELECT tx_id::text, amount, created_at FROM invoice_payments
+         WHERE invoice_id=$1::uuid ORDER BY created_at ASC`, invoiceID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	type P struct {
+		TxID      string    `json:"tx_id"`
+		Amount    int64     `json:"amount"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	var payments []P
+	for rows.Next() {
+		var p P
+		if err := rows.Scan(&p.TxID, &p.Amount, &p.CreatedAt); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		payments = append(payments, p)
+	}
+	rows.Close()
+
+	p := PaymentRequest{WalletID: walletID, Amount: amount, InvoiceID: invoiceID, Memo: memo, ExpiresAt: expiresAt}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"invoice_id":  invoiceID,
+		"wallet_id":   walletID,
+		"address":     address.For(walletID),
+		"amount":      amount,
+		"amount_paid": amountPaid,
+		"amount_due":  max(amount-amountPaid, 0),
+		"memo":        memo,
+		"reference":   reference,
+		"status":      status,
+		"expires_at":  expiresAt,
+		"created_at":  created,
+		"uri":         p.URI(),
+		"qr_payload":  p.QRPayload(),
+		"payments":    payments,
+	})
+}
+
+// ✅ Decode a wallet: URI or QR payload (public)
+func DecodeHandler(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("uri")
+	if raw == "" {
+		http.Error(w, "uri required", http.StatusBadRequest)
+		return
+	}
+	p, err := ParseURI(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"wallet_id":  p.WalletID,
+		"address":    address.For(p.WalletID),
+		"amount":     p.Amount,
+		"invoice_id": p.InvoiceID,
+		"memo":       p.Memo,
+		"expires_at": p.ExpiresAt,
+	})
+}
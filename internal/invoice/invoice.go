@@ -0,0 +1,214 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+)
+
+var dbPool *pgxpool.Pool
+
+func Init(pool *pgxpool.Pool) { dbPool = pool }
+
+var (
+	ErrNotFound    = errors.New("invoice not found")
+	ErrNotPayable  = errors.New("invoice is already paid or expired")
+	ErrWrongWallet = errors.New("invoice is payable to a different wallet")
+)
+
+// PaymentRequest is the part of an invoice a payer needs to build a transfer.
+type PaymentRequest struct {
+	WalletID  string
+	Amount    int64
+	InvoiceID string
+	Memo      string
+	ExpiresAt time.Time
+}
+
+// URI encodes the request as wallet:<address>?amount=..&invoice=..&memo=..&exp=<unix>.
+func (p PaymentRequest) URI() string {
+	q := url.Values{}
+	q.Set("amount", strconv.FormatInt(p.Amount, 10))
+	if p.InvoiceID != "" {
+		q.Set("invoice", p.InvoiceID)
+	}
+	if p.Memo != "" {
+		q.Set("memo", p.Memo)
+	}
+	if !p.ExpiresAt.IsZero() {
+		q.Set("exp", strconv.FormatInt(p.ExpiresAt.Unix(), 10))
+	}
+	return "wallet:" + displayAddress(p.WalletID) + "?" + q.Encode()
+}
+
+// QRPayload is a compact form restricted to the QR alphanumeric character set
+// (upper case, digits, ':' and '-'), so it fits a smaller code than the URI.
+// The memo is dropped; payers fetch it through the invoice ID.
+func (p PaymentRequest) QRPayload() string {
+	return strings.ToUpper(fmt.Sprintf("WALLET:%s:%d:%s", displayAddress(p.WalletID), p.Amount, p.InvoiceID))
+}
+
+// ParseURI decodes either a wallet: URI or a QR payload.
+func ParseURI(s string) (*PaymentRequest, error) {
+	if strings.HasPrefix(s, "WALLET:") {
+		parts := strings.Split(s, ":")
+		if len(parts) != 4 {
+			return nil, errors.New("malformed QR payload")
+		}
+		walletID, err := address.Parse(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		amount, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || amount <= 0 {
+			return nil, errors.New("invalid amount")
+		}
+		return &PaymentRequest{
+			WalletID:  walletID,
+			Amount:    amount,
+			InvoiceID: strings.ToLower(parts[3]),
+		}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "wallet" || u.Opaque == "" {
+		return nil, errors.New("not a wallet: URI")
+	}
+	walletID, err := address.Parse(u.Opaque)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	p := &PaymentRequest{
+		WalletID:  walletID,
+		InvoiceID: q.Get("invoice"),
+		Memo:      q.Get("memo"),
+	}
+	if p.Amount, err = strconv.ParseInt(q.Get("amount"), 10, 64); err != nil || p.Amount <= 0 {
+		return nil, errors.New("invalid amount")
+	}
+	if exp := q.Get("exp"); exp != "" {
+		sec, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid exp")
+		}
+		p.ExpiresAt = time.Unix(sec, 0).UTC()
+	}
+	return p, nil
+}
+
+// displayAddress prefers the checksummed address; IDs that are not wallet
+// hashes are shown as they are.
+func displayAddress(walletID string) string {
+	if a := address.For(walletID); a != "" {
+		return a
+	}
+	return walletID
+}
+
+// FromNote extracts an invoice ID from a transfer note of the form "invoice:<id>".
+func FromNote(note string) string {
+	if id, ok := strings.CutPrefix(note, "invoice:"); ok {
+		return strings.TrimSpace(id)
+	}
+	return ""
+}
+
+// expireStale moves unpaid invoices past their expiry to 'expired'.
+func expireStale(ctx context.Context) {
+	_, _ = dbPool.Exec(ctx,
+		`UPDATE invoices SET status='expired'
+         WHERE status IN ('open','partially_paid') AND expires_at < NOW()`)
+}
+
+// Payable checks that an invoice can still receive a payment to toWalletID.
+func Payable(ctx context.Context, invoiceID, toWalletID string) error {
+	expireStale(ctx)
+
+	var walletID, status string
+	err := dbPool.QueryRow(ctx,
+		`SELECT wallet_id, status FROM invoices WHERE invoice_id=$1::uuid`, invoiceID).
+		Scan(&walletID, &status)
+	if err != nil {
+		return ErrNotFound
+	}
+	if status != "open" && status != "partially_paid" {
+		return ErrNotPayable
+	}
+	if walletID != toWalletID {
+		return ErrWrongWallet
+	}
+	return nil
+}
+
+// RecordPayment matches a pending transaction to an invoice and advances its
+// status, inside the transaction that records the transfer. The invoice row is
+// locked and checked again, so concurrent payers cannot both pay an invoice
+// that only one of them may close. The payment is undone by ReversePayment if
+// the transaction is dropped.
+func RecordPayment(ctx context.Context, tx pgx.Tx, invoiceID, toWalletID, txID string, amount int64) (string, error) {
+	var walletID, status string
+	var expired bool
+	err := tx.QueryRow(ctx,
+		`SELECT wallet_id, status, COALESCE(expires_at < NOW(), false) FROM invoices WHERE invoice_id=$1::uuid FOR UPDATE`, invoiceID).
+		Scan(&walletID, &status, &expired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if (status != "open" && status != "partially_paid") || expired {
+		return "", ErrNotPayable
+	}
+	if walletID != toWalletID {
+		return "", ErrWrongWallet
+	}
+
+	// Each transaction is new here, so it is matched at most once.
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO invoice_payments (invoice_id, tx_id, amount) VALUES ($1::uuid,$2::uuid,$3)`,
+		invoiceID, txID, amount); err != nil {
+		return "", err
+	}
+	err = tx.QueryRow(ctx,
+		`UPDATE invoices
+         SET amount_paid = amount_paid + $2,
+             status = CASE WHEN amount_paid + $2 >= amount THEN 'paid' ELSE 'partially_paid' END,
+             paid_at = CASE WHEN amount_paid + $2 >= amount THEN NOW() ELSE paid_at END
+         WHERE invoice_id=$1::uuid
+         RETURNING status`, invoiceID, amount).Scan(&status)
+	return status, err
+}
+
+// ReversePayment undoes the invoice payment made by txID, if any, when the
+// transaction is rejected, expired or replaced. It runs inside the caller's
+// status change so the two cannot disagree.
+func ReversePayment(ctx context.Context, q pgx.Tx, txID string) error {
+	_, err := q.Exec(ctx,
+		`WITH gone AS (
+             DELETE FROM invoice_payments WHERE tx_id=$1::uuid RETURNING invoice_id, amount
+         )
+         UPDATE invoices i
+         SET amount_paid = i.amount_paid - g.amount,
+             status = CASE WHEN i.amount_paid - g.amount >= i.amount THEN 'paid'
+                           WHEN i.expires_at < NOW() THEN 'expired'
+                           WHEN i.amount_paid - g.amount > 0 THEN 'partially_paid'
+                           ELSE 'open' END,
+             paid_at = CASE WHEN i.amount_paid - g.amount >= i.amount THEN i.paid_at END
+         FROM gone g
+         WHERE i.invoice_id = g.invoice_id`, txID)
+	if err != nil {
+		return fmt.Errorf("reverse invoice payment of %s: %w", txID, err)
+	}
+	return nil
+}
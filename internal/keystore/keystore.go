@@ -0,0 +1,213 @@
+// Package keystore implements the encrypted key file used by cmd/walletcli
+// and by the wallet export/import endpoints.
+//
+// A keystore holds one private key encrypted with AES-256-GCM under a key
+// derived from a passphrase with scrypt or Argon2id. The derived key is 64
+// bytes: the first half encrypts, the second half keys an HMAC-SHA256 over
+// the ciphertext so a wrong passphrase is reported as such before decryption
+// is attempted.
+package keystore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+)
+
+const Version = 1
+
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrUnsupported     = errors.New("unsupported keystore")
+)
+
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+)
+
+// KDFParams selects and configures the passphrase key derivation.
+type KDFParams struct {
+	Name string `json:"name"` // scrypt | argon2id
+	Salt string `json:"salt"` // hex
+
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	// argon2id
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"` // KiB
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// Upper bounds on KDF parameters. Keystores are uploaded by users, so a file
+// asking for more memory or time than any sane default is refused before
+// deriving rather than allowed to exhaust the server.
+const (
+	MaxScryptN      = 1 << 18
+	MaxScryptR      = 16
+	MaxScryptP      = 4
+	MaxArgon2Memory = 256 * 1024 // KiB
+	MaxArgon2Time   = 10
+	MaxArgon2Thread = 8
+)
+
+// DefaultScrypt returns scrypt parameters with a fresh salt.
+func DefaultScrypt() KDFParams {
+	return KDFParams{Name: KDFScrypt, Salt: newSalt(), N: 1 << 17, R: 8, P: 1}
+}
+
+// DefaultArgon2id returns Argon2id parameters with a fresh salt.
+func DefaultArgon2id() KDFParams {
+	return KDFParams{Name: KDFArgon2id, Salt: newSalt(), Time: 3, Memory: 64 * 1024, Threads: 4}
+}
+
+func newSalt() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Derive stretches a passphrase into keyLen bytes.
+func (k KDFParams) Derive(passphrase string, keyLen int) ([]byte, error) {
+	salt, err := hex.DecodeString(k.Salt)
+	if err != nil || len(salt) < 16 {
+		return nil, fmt.Errorf("%w: bad salt", ErrUnsupported)
+	}
+	switch k.Name {
+	case KDFScrypt:
+		if k.N <= 1 || k.N&(k.N-1) != 0 || k.R < 1 || k.P < 1 {
+			return nil, fmt.Errorf("%w: bad scrypt parameters", ErrUnsupported)
+		}
+		if k.N > MaxScryptN || k.R > MaxScryptR || k.P > MaxScryptP {
+			return nil, fmt.Errorf("%w: scrypt parameters above limits", ErrUnsupported)
+		}
+		return scrypt.Key([]byte(passphrase), salt, k.N, k.R, k.P, keyLen)
+	case KDFArgon2id:
+		if k.Time == 0 || k.Memory == 0 || k.Threads == 0 {
+			return nil, fmt.Errorf("%w: bad argon2id parameters", ErrUnsupported)
+		}
+		if k.Time > MaxArgon2Time || k.Memory > MaxArgon2Memory || k.Threads > MaxArgon2Thread {
+			return nil, fmt.Errorf("%w: argon2id parameters above limits", ErrUnsupported)
+		}
+		return argon2.IDKey([]byte(passphrase), salt, k.Time, k.Memory, k.Threads, uint32(keyLen)), nil
+	}
+	return nil, fmt.Errorf("%w: kdf %q", ErrUnsupported, k.Name)
+}
+
+type Crypto struct {
+	Cipher     string    `json:"cipher"`     // aes-256-gcm
+	Ciphertext string    `json:"ciphertext"` // base64 nonce||sealed, as crypto.EncryptBytesAESGCM
+	KDF        KDFParams `json:"kdf"`
+	MAC        string    `json:"mac"` // hex HMAC-SHA256(macKey, ciphertext)
+}
+
+// File is the JSON keystore document.
+type File struct {
+	Version   int       `json:"version"`
+	WalletID  string    `json:"wallet_id"`
+	PublicKey string    `json:"public_key"`
+	KeyType   string    `json:"key_type"`
+	Crypto    Crypto    `json:"crypto"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Seal encrypts a private key scalar under passphrase.
+func Seal(privKey []byte, publicKey, keyType, passphrase string, kdf KDFParams) (*File, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase required")
+	}
+	dk, err := kdf.Derive(passphrase, 64)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := crypto.EncryptBytesAESGCM(dk[:32], privKey)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		Version:   Version,
+		WalletID:  crypto.WalletHashFromPublicKeyHex(publicKey),
+		PublicKey: publicKey,
+		KeyType:   keyType,
+		Crypto: Crypto{
+			Cipher:     "aes-256-gcm",
+			Ciphertext: ct,
+			KDF:        kdf,
+			MAC:        mac(dk[32:], ct),
+		},
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Open decrypts the private key scalar.
+func (f *File) Open(passphrase string) ([]byte, error) {
+	if f.Version != Version || f.Crypto.Cipher != "aes-256-gcm" {
+		return nil, ErrUnsupported
+	}
+	dk, err := f.Crypto.KDF.Derive(passphrase, 64)
+	if err != nil {
+		return nil, err
+	}
+	want, err := hex.DecodeString(f.Crypto.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad mac", ErrUnsupported)
+	}
+	got, _ := hex.DecodeString(mac(dk[32:], f.Crypto.Ciphertext))
+	if !hmac.Equal(want, got) {
+		return nil, ErrWrongPassphrase
+	}
+	return crypto.DecryptBytesAESGCM(dk[:32], f.Crypto.Ciphertext)
+}
+
+func mac(key []byte, ciphertext string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(ciphertext))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Load reads a keystore file.
+func Load(path string) (*File, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return &f, nil
+}
+
+// Save writes the keystore readable by the owner only. An existing file is
+// never overwritten.
+func (f *File) Save(path string) error {
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(append(raw, '\n')); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,57 @@
+// Package kms manages the server's master keys. Data keys of master-wrapped
+// wallet envelopes (see internal/envelope) are wrapped and unwrapped here,
+// and custodial wallet keys are only ever opened here to sign, so no other
+// code handles a master key. Local keeps its key ring in an encrypted file; a
+// hosted KMS can replace it by implementing KeyManager and passing it to Init.
+package kms
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+)
+
+var ErrKeyMismatch = errors.New("stored key does not match wallet")
+
+// KeyManager holds the master keys.
+type KeyManager interface {
+	// WrapKey encrypts a data key under the current master key.
+	WrapKey(ctx context.Context, dek []byte) (keyID, wrapped string, err error)
+	// UnwrapKey decrypts a data key wrapped under the master key keyID.
+	UnwrapKey(ctx context.Context, keyID, wrapped string) ([]byte, error)
+	// Sign opens a wallet key envelope and signs with it. The key itself
+	// is never returned.
+	Sign(ctx context.Context, req SignRequest) (r, s string, err error)
+	// Rotate makes a new master key current. Earlier keys still unwrap, so
+	// existing envelopes keep working until they are rewrapped.
+	Rotate(ctx context.Context) (keyID string, err error)
+	// CurrentKeyID is the ID new data keys are wrapped under; empty when
+	// there is no master key.
+	CurrentKeyID() string
+}
+
+// SignRequest names a stored wallet key and the payload to sign.
+type SignRequest struct {
+	KeyType    string // wallets.key_type
+	PublicKey  string // wallets.public_key; the opened key must match it
+	Envelope   string // wallets.private_key_enc
+	Passphrase string // only for passphrase-wrapped envelopes
+	Payload    []byte
+}
+
+var manager KeyManager
+
+// Init installs km for signing and for master-wrapped envelopes.
+func Init(km KeyManager) {
+	manager = km
+	envelope.UseKeyWrapper(km)
+}
+
+// Sign signs with the installed key manager.
+func Sign(ctx context.Context, req SignRequest) (string, string, error) {
+	if manager == nil {
+		return "", "", envelope.ErrNoMasterKey
+	}
+	return manager.Sign(ctx, req)
+}
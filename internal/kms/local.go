@@ -0,0 +1,341 @@
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/keystore"
+)
+
+const fileVersion = 1
+
+var (
+	ErrWrongPassphrase = errors.New("wrong key file passphrase")
+	ErrNoKeyFile       = errors.New("key rotation needs a key file (WALLET_KMS_FILE)")
+)
+
+type masterKey struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"` // 32 bytes, hex
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type keyRing struct {
+	Current string      `json:"current"`
+	Keys    []masterKey `json:"keys"`
+}
+
+// keyFile is the on-disk form: the key ring JSON encrypted under a key
+// derived from the file passphrase.
+type keyFile struct {
+	Version    int                `json:"version"`
+	KDF        keystore.KDFParams `json:"kdf"`
+	Ciphertext string             `json:"ciphertext"` // base64 nonce||sealed, as crypto.EncryptBytesAESGCM
+}
+
+var _ KeyManager = (*Local)(nil)
+
+// Local is a KeyManager whose master keys live in process memory, loaded from
+// and saved to an encrypted key file. Without a file it holds at most the key
+// it was created with and cannot rotate. When another process rotates the
+// file, Reload picks up the new ring; unwrapping under an unknown key ID
+// reloads by itself.
+type Local struct {
+	mu         sync.RWMutex
+	path       string
+	passphrase string
+	ring       keyRing
+	modTime    time.Time // of the key file when last read or written
+}
+
+// KeyID identifies a master key without revealing it. Envelopes written
+// before the key manager recorded the same ID for WALLET_MASTER_KEY.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("wallet-master-key|"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// MasterKeyFromEnv reads the 32-byte master key hex encoded in
+// WALLET_MASTER_KEY; nil when unset.
+func MasterKeyFromEnv() ([]byte, error) {
+	v := strings.TrimSpace(os.Getenv("WALLET_MASTER_KEY"))
+	if v == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(v)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("WALLET_MASTER_KEY must be 64 hex characters")
+	}
+	return key, nil
+}
+
+// FromEnv builds the server's key manager. With WALLET_KMS_FILE set, keys are
+// kept in that file, encrypted under WALLET_KMS_PASSPHRASE; otherwise the
+// only master key is WALLET_MASTER_KEY, if any. Either way WALLET_MASTER_KEY
+// is part of the key ring, so envelopes wrapped with it stay readable.
+func FromEnv() (*Local, error) {
+	legacy, err := MasterKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimSpace(os.Getenv("WALLET_KMS_FILE"))
+	if path == "" {
+		return NewLocal(legacy), nil
+	}
+	return OpenLocal(path, os.Getenv("WALLET_KMS_PASSPHRASE"), legacy)
+}
+
+// NewLocal returns an in-memory manager holding key, or no master key when
+// key is nil.
+func NewLocal(key []byte) *Local {
+	l := &Local{}
+	if key != nil {
+		l.add(key)
+	}
+	return l
+}
+
+// OpenLocal loads the key file at path, creating it when missing. seed, when
+// not nil, is added to the ring if absent; a new file starts with seed as its
+// current key, or a random one.
+func OpenLocal(path, passphrase string, seed []byte) (*Local, error) {
+	if len(passphrase) < envelope.MinPassphraseLen {
+		return nil, fmt.Errorf("WALLET_KMS_PASSPHRASE must be at least %d characters", envelope.MinPassphraseLen)
+	}
+	l := &Local{path: path, passphrase: passphrase}
+	ring, modTime, err := l.read()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if seed == nil {
+			if seed, err = randomKey(); err != nil {
+				return nil, err
+			}
+		}
+		l.add(seed)
+		return l, l.save()
+	case err != nil:
+		return nil, err
+	}
+	l.ring, l.modTime = ring, modTime
+	if seed != nil && l.lookup(KeyID(seed)) == nil {
+		current := l.ring.Current
+		l.add(seed)
+		l.ring.Current = current
+		return l, l.save()
+	}
+	return l, nil
+}
+
+// read decrypts the key file, returning its ring and modification time.
+func (l *Local) read() (keyRing, time.Time, error) {
+	var ring keyRing
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return ring, time.Time{}, err
+	}
+	raw, err := os.ReadFile(l.path)
+	if err != nil {
+		return ring, time.Time{}, err
+	}
+	var f keyFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return ring, time.Time{}, fmt.Errorf("invalid key file: %w", err)
+	}
+	if f.Version != fileVersion {
+		return ring, time.Time{}, fmt.Errorf("unsupported key file version %d", f.Version)
+	}
+	fk, err := f.KDF.Derive(l.passphrase, 32)
+	if err != nil {
+		return ring, time.Time{}, err
+	}
+	plain, err := crypto.DecryptBytesAESGCM(fk, f.Ciphertext)
+	if err != nil {
+		return ring, time.Time{}, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plain, &ring); err != nil {
+		return ring, time.Time{}, fmt.Errorf("invalid key ring: %w", err)
+	}
+	return ring, fi.ModTime(), nil
+}
+
+// Reload re-reads the key file if it changed since it was last read, so keys
+// added by cmd/kmsrotate are used without a restart. It does nothing for a
+// manager without a file.
+func (l *Local) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	l.mu.RLock()
+	unchanged := fi.ModTime().Equal(l.modTime)
+	l.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	ring, modTime, err := l.read()
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ring, l.modTime = ring, modTime
+	return nil
+}
+
+func randomKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// add appends key to the ring and makes it current.
+func (l *Local) add(key []byte) string {
+	id := KeyID(key)
+	l.ring.Keys = append(l.ring.Keys, masterKey{ID: id, Key: hex.EncodeToString(key), CreatedAt: time.Now().UTC()})
+	l.ring.Current = id
+	return id
+}
+
+func (l *Local) lookup(id string) []byte {
+	i := slices.IndexFunc(l.ring.Keys, func(k masterKey) bool { return k.ID == id })
+	if i < 0 {
+		return nil
+	}
+	key, _ := hex.DecodeString(l.ring.Keys[i].Key)
+	return key
+}
+
+// save writes the ring to a temporary file and renames it over the key file,
+// so a crash never leaves a half-written ring.
+func (l *Local) save() error {
+	plain, err := json.Marshal(l.ring)
+	if err != nil {
+		return err
+	}
+	kdf := keystore.DefaultScrypt()
+	fk, err := kdf.Derive(l.passphrase, 32)
+	if err != nil {
+		return err
+	}
+	ct, err := crypto.EncryptBytesAESGCM(fk, plain)
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(keyFile{Version: fileVersion, KDF: kdf, Ciphertext: ct}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".kms-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(l.path); err == nil {
+		l.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+func (l *Local) CurrentKeyID() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ring.Current
+}
+
+func (l *Local) WrapKey(ctx context.Context, dek []byte) (string, string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	key := l.lookup(l.ring.Current)
+	if key == nil {
+		return "", "", envelope.ErrNoMasterKey
+	}
+	wrapped, err := crypto.EncryptBytesAESGCM(key, dek)
+	return l.ring.Current, wrapped, err
+}
+
+func (l *Local) UnwrapKey(ctx context.Context, keyID, wrapped string) ([]byte, error) {
+	l.mu.RLock()
+	key, empty := l.lookup(keyID), len(l.ring.Keys) == 0
+	l.mu.RUnlock()
+	if key == nil {
+		// The key may have been added to the file by a rotation since it was read
+		if err := l.Reload(); err != nil {
+			return nil, err
+		}
+		l.mu.RLock()
+		key, empty = l.lookup(keyID), len(l.ring.Keys) == 0
+		l.mu.RUnlock()
+	}
+	if empty {
+		return nil, envelope.ErrNoMasterKey
+	}
+	if key == nil {
+		return nil, envelope.ErrWrongMasterKey
+	}
+	return crypto.DecryptBytesAESGCM(key, wrapped)
+}
+
+func (l *Local) Sign(ctx context.Context, req SignRequest) (string, string, error) {
+	kt, err := crypto.LookupKeyType(req.KeyType)
+	if err != nil {
+		return "", "", err
+	}
+	d, err := envelope.OpenWith(req.Envelope, req.Passphrase, l)
+	if err != nil {
+		return "", "", err
+	}
+	defer clear(d)
+	priv, err := kt.PrivateKeyFromBytes(d)
+	if err != nil || priv.Public().Hex() != req.PublicKey {
+		return "", "", ErrKeyMismatch
+	}
+	return priv.Sign(req.Payload)
+}
+
+// Rotate adds a random master key, makes it current and saves the key file.
+func (l *Local) Rotate(ctx context.Context) (string, error) {
+	if l.path == "" {
+		return "", ErrNoKeyFile
+	}
+	key, err := randomKey()
+	if err != nil {
+		return "", err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prev := l.ring
+	id := l.add(key)
+	if err := l.save(); err != nil {
+		l.ring = prev
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,219 @@
+package mempool
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrExists   = errors.New("transaction already in mempool")
+	ErrConflict = errors.New("input already spent by a mempool transaction")
+)
+
+// Size constants for the serialized-size estimate used in fee rates.
+const (
+	baseSize   = 10
+	inputSize  = 148
+	outputSize = 34
+)
+
+// EstimateSize approximates the serialized size in bytes of a transaction with
+// the given number of inputs and outputs.
+func EstimateSize(inputs, outputs int) int {
+	return baseSize + inputs*inputSize + outputs*outputSize
+}
+
+// Entry is a validated pending transaction held in memory.
+type Entry struct {
+	TxID    string    `json:"tx_id"`
+	From    string    `json:"from_wallet_id"`
+	To      string    `json:"to_wallet_id"`
+	Amount  int64     `json:"amount"`
+	Fee     int64     `json:"fee"`
+	Size    int       `json:"size"`
+	Inputs  []string  `json:"inputs"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// FeeRate is the fee paid per estimated byte.
+func (e *Entry) FeeRate() float64 {
+	if e.Size <= 0 {
+		return 0
+	}
+	return float64(e.Fee) / float64(e.Size)
+}
+
+// higherPriority orders entries by fee rate, then by arrival.
+func higherPriority(a, b *Entry) bool {
+	if ra, rb := a.FeeRate(), b.FeeRate(); ra != rb {
+		return ra > rb
+	}
+	return a.AddedAt.Before(b.AddedAt)
+}
+
+type EventType string
+
+const (
+	EventAdded   EventType = "added"
+	EventRemoved EventType = "removed"
+)
+
+// Event is published to subscribers whenever the pool changes.
+type Event struct {
+	Type   EventType `json:"type"`
+	TxID   string    `json:"tx_id"`
+	Reason string    `json:"reason,omitempty"` // committed, rejected, expired... for removals
+	Entry  *Entry    `json:"entry,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Pool holds pending transactions indexed by ID, by spent input and by fee rate.
+type Pool struct {
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	byInput map[string]string // utxo_id → tx_id
+	byFee   []*Entry          // sorted by higherPriority
+
+	subMu  sync.Mutex
+	subs   map[int]chan Event
+	nextID int
+}
+
+func New() *Pool {
+	return &Pool{
+		entries: make(map[string]*Entry),
+		byInput: make(map[string]string),
+		subs:    make(map[int]chan Event),
+	}
+}
+
+// Add inserts a transaction unless it is already present or spends an input
+// claimed by another entry.
+func (p *Pool) Add(e *Entry) error {
+	p.mu.Lock()
+	if _, ok := p.entries[e.TxID]; ok {
+		p.mu.Unlock()
+		return ErrExists
+	}
+	for _, in := range e.Inputs {
+		if _, ok := p.byInput[in]; ok {
+			p.mu.Unlock()
+			return ErrConflict
+		}
+	}
+	if e.AddedAt.IsZero() {
+		e.AddedAt = time.Now()
+	}
+	p.entries[e.TxID] = e
+	for _, in := range e.Inputs {
+		p.byInput[in] = e.TxID
+	}
+	i := sort.Search(len(p.byFee), func(i int) bool { return higherPriority(e, p.byFee[i]) })
+	p.byFee = append(p.byFee, nil)
+	copy(p.byFee[i+1:], p.byFee[i:])
+	p.byFee[i] = e
+	p.mu.Unlock()
+
+	p.publish(Event{Type: EventAdded, TxID: e.TxID, Entry: e, At: time.Now()})
+	return nil
+}
+
+// Remove drops a transaction; it reports whether the transaction was present.
+func (p *Pool) Remove(txID, reason string) bool {
+	p.mu.Lock()
+	e, ok := p.entries[txID]
+	if !ok {
+		p.mu.Unlock()
+		return false
+	}
+	delete(p.entries, txID)
+	for _, in := range e.Inputs {
+		if p.byInput[in] == txID {
+			delete(p.byInput, in)
+		}
+	}
+	for i, x := range p.byFee {
+		if x == e {
+			p.byFee = append(p.byFee[:i], p.byFee[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	p.publish(Event{Type: EventRemoved, TxID: txID, Reason: reason, At: time.Now()})
+	return true
+}
+
+func (p *Pool) Get(txID string) (*Entry, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	e, ok := p.entries[txID]
+	return e, ok
+}
+
+// Conflicts returns the mempool transactions already spending any of inputs.
+func (p *Pool) Conflicts(inputs []string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	seen := map[string]bool{}
+	var out []string
+	for _, in := range inputs {
+		if id, ok := p.byInput[in]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Top returns up to n entries in fee-rate order; n <= 0 returns all.
+func (p *Pool) Top(n int) []*Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if n <= 0 || n > len(p.byFee) {
+		n = len(p.byFee)
+	}
+	out := make([]*Entry, n)
+	copy(out, p.byFee[:n])
+	return out
+}
+
+func (p *Pool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.entries)
+}
+
+// Subscribe registers a listener. Events are dropped for a subscriber whose
+// buffer is full rather than blocking the pool. Call the returned func to stop.
+func (p *Pool) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	p.subMu.Lock()
+	id := p.nextID
+	p.nextID++
+	p.subs[id] = ch
+	p.subMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.subMu.Lock()
+			delete(p.subs, id)
+			p.subMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (p *Pool) publish(ev Event) {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	for _, ch := range p.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
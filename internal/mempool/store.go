@@ -0,0 +1,57 @@
+package mempool
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var dbPool *pgxpool.Pool
+
+// Default is the process-wide mempool shared by tx, block and zakat.
+var Default = New()
+
+// Init restores the mempool from Postgres. Pending rows in transactions are
+// the durable copy; the in-memory indexes are rebuilt from them at startup.
+func Init(pool *pgxpool.Pool) {
+	dbPool = pool
+	n, err := Default.Load(context.Background())
+	if err != nil {
+		log.Printf("mempool load error: %v", err)
+		return
+	}
+	log.Printf("mempool restored %d pending transactions", n)
+}
+
+// Load adds every pending transaction in the database to the pool.
+func (p *Pool) Load(ctx context.Context) (int, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT t.tx_id::text, t.from_wallet_id, t.to_wallet_id, t.amount, t.fee, t.created_at,
+                COALESCE((SELECT array_agg(ti.utxo_id::text) FROM transaction_inputs ti WHERE ti.tx_id = t.tx_id), '{}'),
+                (SELECT COUNT(*) FROM transaction_outputs o WHERE o.tx_id = t.tx_id)
+         FROM transactions t
+         WHERE t.status='pending'
+         ORDER BY t.created_at ASC`)
+	if err != nil {
+		return 0, fmt.Errorf("query pending: %w", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		e := &Entry{}
+		var outputs int
+		if err := rows.Scan(&e.TxID, &e.From, &e.To, &e.Amount, &e.Fee, &e.AddedAt, &e.Inputs, &outputs); err != nil {
+			return n, fmt.Errorf("scan pending: %w", err)
+		}
+		e.Size = EstimateSize(len(e.Inputs), outputs)
+		if err := p.Add(e); err != nil {
+			log.Printf("mempool skip %s: %v", e.TxID, err)
+			continue
+		}
+		n++
+	}
+	return n, rows.Err()
+}
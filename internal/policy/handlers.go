@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/audit"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+type SetRequest struct {
+	Policy
+	OTP string `json:"otp"` // from /auth/reauth; required to change an existing policy
+}
+
+// ✅ Read (GET), set (POST) or remove (DELETE ?wallet_id=&otp=) a wallet's spending policy
+//
+// Replacing or removing a policy loosens it as easily as tightening it, so
+// both need owner re-authentication once a policy exists.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+	ctx := context.Background()
+
+	switch r.Method {
+	case http.MethodGet:
+		walletID, err := address.FromQuery(r, "wallet_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := wallet.EnsureWalletOwnedByUser(dbPool, walletID, userID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		p, err := Load(ctx, walletID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if p == nil {
+			http.Error(w, "no policy", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+
+	case http.MethodPost:
+		var req SetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WalletID == "" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := address.Normalize(&req.WalletID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i := range req.Allowlist {
+			if err := address.Normalize(&req.Allowlist[i]); err != nil {
+				http.Error(w, "allowlist: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := wallet.EnsureWalletOwnedByUser(dbPool, req.WalletID, userID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err := req.Policy.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !reauthenticate(ctx, w, req.WalletID, userID, req.OTP) {
+			return
+		}
+		if err := Save(ctx, &req.Policy); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		record(r, userID, req.WalletID, "wallet.policy_set")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req.Policy)
+
+	case http.MethodDelete:
+		walletID, err := address.FromQuery(r, "wallet_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := wallet.EnsureWalletOwnedByUser(dbPool, walletID, userID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if !reauthenticate(ctx, w, walletID, userID, r.URL.Query().Get("otp")) {
+			return
+		}
+		if err := Delete(ctx, walletID); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		record(r, userID, walletID, "wallet.policy_delete")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// reauthenticate requires a valid OTP when the wallet already has a policy,
+// writing the error response otherwise.
+func reauthenticate(ctx context.Context, w http.ResponseWriter, walletID, userID, otp string) bool {
+	existing, err := Load(ctx, walletID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return false
+	}
+	if existing == nil {
+		return true
+	}
+	err = auth.ConsumeOTP(ctx, userID, auth.PurposePolicyChange, otp)
+	if errors.Is(err, auth.ErrOTPLocked) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return false
+	}
+	if errors.Is(err, auth.ErrInvalidOTP) {
+		http.Error(w, "re-authentication required: request a policy_change OTP from /auth/reauth", http.StatusUnauthorized)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func record(r *http.Request, userID, walletID, action string) {
+	if err := audit.Record(context.Background(), audit.Event{
+		Action: action, Outcome: audit.Success, UserID: userID, WalletID: walletID, RemoteIP: audit.RemoteIP(r),
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+// Package policy stores per-wallet spending rules and checks transfers
+// against them.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var dbPool *pgxpool.Pool
+
+func Init(pool *pgxpool.Pool) { dbPool = pool }
+
+// Rules, as reported in a Violation.
+const (
+	RulePerTx     = "per_tx_max"
+	RuleDaily     = "daily_cap"
+	RuleMonthly   = "monthly_cap"
+	RuleAllowlist = "allowlist"
+	RuleWindow    = "time_window"
+)
+
+type Policy struct {
+	WalletID    string    `json:"wallet_id"`
+	PerTxMax    int64     `json:"per_tx_max"`   // 0 = no limit
+	DailyCap    int64     `json:"daily_cap"`    // 0 = no limit
+	MonthlyCap  int64     `json:"monthly_cap"`  // 0 = no limit
+	Allowlist   []string  `json:"allowlist"`    // recipient wallet IDs; empty allows any
+	WindowStart string    `json:"window_start"` // HH:MM; empty allows any time
+	WindowEnd   string    `json:"window_end"`   // HH:MM, exclusive; before WindowStart wraps midnight
+	Timezone    string    `json:"timezone"`     // IANA name for caps and window; default UTC
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Querier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Violation is returned by Check when a transfer breaks a rule.
+type Violation struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+func (v *Violation) Error() string { return "policy " + v.Rule + ": " + v.Reason }
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate checks and normalizes a policy before it is stored.
+func (p *Policy) Validate() error {
+	if p.PerTxMax < 0 || p.DailyCap < 0 || p.MonthlyCap < 0 {
+		return errors.New("limits cannot be negative")
+	}
+	if p.Timezone == "" {
+		p.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	if (p.WindowStart == "") != (p.WindowEnd == "") {
+		return errors.New("window_start and window_end go together")
+	}
+	if p.WindowStart != "" {
+		start, err := parseClock(p.WindowStart)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(p.WindowEnd)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return errors.New("empty time window")
+		}
+	}
+	if p.Allowlist == nil {
+		p.Allowlist = []string{}
+	}
+	return nil
+}
+
+// inWindow reports whether now falls inside the policy's time-of-day window.
+func (p *Policy) inWindow(now time.Time) bool {
+	if p.WindowStart == "" {
+		return true
+	}
+	start, _ := parseClock(p.WindowStart)
+	end, _ := parseClock(p.WindowEnd)
+	m := now.Hour()*60 + now.Minute()
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// Load returns the wallet's policy, or nil when it has none.
+func Load(ctx context.Context, walletID string) (*Policy, error) {
+	return load(ctx, dbPool, walletID)
+}
+
+func load(ctx context.Context, q Querier, walletID string) (*Policy, error) {
+	p := Policy{WalletID: walletID}
+	var start, end *string
+	err := q.QueryRow(ctx,
+		`SELECT per_tx_max, daily_cap, monthly_cap, allowlist, window_start, window_end, timezone, updated_at
+         FROM wallet_policies WHERE wallet_id=$1`, walletID).
+		Scan(&p.PerTxMax, &p.DailyCap, &p.MonthlyCap, &p.Allowlist, &start, &end, &p.Timezone, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if start != nil && end != nil {
+		p.WindowStart, p.WindowEnd = *start, *end
+	}
+	return &p, nil
+}
+
+// Save stores a validated policy, replacing any previous one.
+func Save(ctx context.Context, p *Policy) error {
+	var start, end any
+	if p.WindowStart != "" {
+		start, end = p.WindowStart, p.WindowEnd
+	}
+	return dbPool.QueryRow(ctx,
+		`INSERT INTO wallet_policies (wallet_id, per_tx_max, daily_cap, monthly_cap, allowlist, window_start, window_end, timezone, updated_at)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,NOW())
+         ON CONFLICT (wallet_id) DO UPDATE SET
+            per_tx_max=$2, daily_cap=$3, monthly_cap=$4, allowlist=$5,
+            window_start=$6, window_end=$7, timezone=$8, updated_at=NOW()
+         RETURNING updated_at`,
+		p.WalletID, p.PerTxMax, p.DailyCap, p.MonthlyCap, p.Allowlist, start, end, p.Timezone).
+		Scan(&p.UpdatedAt)
+}
+
+// Inherit copies the policy of walletID to successorID unless the successor
+// already has one, so rotating a wallet does not shed its limits. It runs in
+// the transaction that records the rotation.
+func Inherit(ctx context.Context, q pgx.Tx, walletID, successorID string) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO wallet_policies (wallet_id, per_tx_max, daily_cap, monthly_cap, allowlist, window_start, window_end, timezone, updated_at)
+         SELECT $2, per_tx_max, daily_cap, monthly_cap, allowlist, window_start, window_end, timezone, NOW()
+         FROM wallet_policies WHERE wallet_id=$1
+         ON CONFLICT (wallet_id) DO NOTHING`, walletID, successorID)
+	return err
+}
+
+// Delete removes the wallet's policy.
+func Delete(ctx context.Context, walletID string) error {
+	_, err := dbPool.Exec(ctx, `DELETE FROM wallet_policies WHERE wallet_id=$1`, walletID)
+	return err
+}
+
+// spentSince sums what the wallet sent to other wallets since a time.
+// Dropped transactions do not count.
+func spentSince(ctx context.Context, q Querier, walletID string, since time.Time) (int64, error) {
+	var sum int64
+	err := q.QueryRow(ctx,
+		`SELECT COALESCE(SUM(amount),0) FROM transactions
+         WHERE from_wallet_id=$1 AND to_wallet_id <> from_wallet_id AND created_at >= $2
+           AND status NOT IN ('rejected','expired','replaced')`, walletID, since).Scan(&sum)
+	return sum, err
+}
+
+// Check tests a transfer of amount to toWalletID against the sender's policy.
+// It returns a *Violation for the first rule broken, nil when the transfer
+// is allowed or the wallet has no policy, or another error on failure.
+// Transfers to the wallet itself spend nothing and are always allowed. Run it
+// in the transaction that records the transfer, with the sender's wallet row
+// locked, so concurrent transfers are counted against the caps in turn.
+func Check(ctx context.Context, q Querier, fromWalletID, toWalletID string, amount int64, now time.Time) error {
+	if fromWalletID == toWalletID {
+		return nil
+	}
+	p, err := load(ctx, q, fromWalletID)
+	if err != nil || p == nil {
+		return err
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+
+	if p.PerTxMax > 0 && amount > p.PerTxMax {
+		return &Violation{RulePerTx, fmt.Sprintf("amount %d exceeds the per-transaction maximum of %d", amount, p.PerTxMax)}
+	}
+	if len(p.Allowlist) > 0 && !slices.Contains(p.Allowlist, toWalletID) {
+		return &Violation{RuleAllowlist, "recipient is not on the wallet's allowlist"}
+	}
+	if !p.inWindow(now) {
+		return &Violation{RuleWindow, fmt.Sprintf("sends are only allowed between %s and %s %s", p.WindowStart, p.WindowEnd, p.Timezone)}
+	}
+	if p.DailyCap > 0 {
+		spent, err := spentSince(ctx, q, fromWalletID, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc))
+		if err != nil {
+			return err
+		}
+		if spent+amount > p.DailyCap {
+			return &Violation{RuleDaily, fmt.Sprintf("daily cap of %d would be exceeded (%d already sent today)", p.DailyCap, spent)}
+		}
+	}
+	if p.MonthlyCap > 0 {
+		spent, err := spentSince(ctx, q, fromWalletID, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc))
+		if err != nil {
+			return err
+		}
+		if spent+amount > p.MonthlyCap {
+			return &Violation{RuleMonthly, fmt.Sprintf("monthly cap of %d would be exceeded (%d already sent this month)", p.MonthlyCap, spent)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package pst
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/policy"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+var dbPool *pgxpool.Pool
+
+func Init(pool *pgxpool.Pool) { dbPool = pool }
+
+type UploadRequest struct {
+	Packet string `json:"packet"` // base64 packet, see Encode
+}
+
+type CompleteRequest struct {
+	PstID  string `json:"pst_id"`
+	Packet string `json:"packet"` // optional; more signatures to combine first
+	Nonce  string `json:"nonce"`  // optional; defaults to "pst-<pst_id>"
+}
+
+func status(id string, p *Packet, state, txID string) map[string]any {
+	encoded, _ := p.Encode()
+	return map[string]any{
+		"pst_id":     id,
+		"status":     state,
+		"tx_id":      txID,
+		"signatures": len(p.Signatures),
+		"required":   p.Required(),
+		"complete":   len(p.Signatures) >= p.Required(),
+		"packet":     encoded,
+	}
+}
+
+// ✅ Upload a partially signed transaction, or more signatures for one already uploaded
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req UploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Packet == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	p, err := Decode(req.Packet)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := p.ID()
+
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+
+	stored, state, txID, err := load(ctx, dbTx, id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		// First upload: only the sender wallet's owner can propose a transaction.
+		if err := wallet.EnsureWalletOwnedByUser(dbPool, p.From, userID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err := checkInputs(ctx, dbTx, p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		unsigned := *p
+		unsigned.Signatures = nil
+		stored, state = &unsigned, "open"
+	case err != nil:
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if state != "open" {
+		http.Error(w, "transaction already finalized", http.StatusConflict)
+		return
+	}
+
+	merged, err := Combine(stored, p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	raw, _ := json.Marshal(merged)
+	if _, err := dbTx.Exec(ctx,
+		`INSERT INTO partial_transactions (pst_id, user_id, from_wallet_id, packet)
+         VALUES ($1,$2,$3,$4)
+         ON CONFLICT (pst_id) DO UPDATE SET packet=$4, updated_at=NOW()`,
+		id, userID, merged.From, raw); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status(id, merged, state, txID))
+}
+
+// ✅ Finalize a fully signed transaction and submit it to the pending pool
+func CompleteHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PstID == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+
+	p, state, _, err := load(ctx, dbTx, req.PstID)
+	if err != nil {
+		http.Error(w, "partial transaction not found", http.StatusNotFound)
+		return
+	}
+	if state != "open" {
+		http.Error(w, "transaction already finalized", http.StatusConflict)
+		return
+	}
+	if err := wallet.EnsureWalletOwnedByUser(dbPool, p.From, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if req.Packet != "" {
+		extra, err := Decode(req.Packet)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if p, err = Combine(p, extra); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var senderPub string
+	if err := dbTx.QueryRow(ctx,
+		`SELECT public_key FROM wallets WHERE wallet_id=$1`, p.From).Scan(&senderPub); err != nil {
+		http.Error(w, "invalid sender wallet", http.StatusBadRequest)
+		return
+	}
+	if req.Nonce == "" {
+		req.Nonce = "pst-" + req.PstID
+	}
+	transfer, err := p.Finalize(senderPub, req.Nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The transfer and the finalized packet are recorded together, so a
+	// packet is never left open with its transaction already pending.
+	pending, err := tx.SubmitTx(ctx, dbTx, transfer)
+	if errors.Is(err, tx.ErrInputsUnavailable) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	var v *policy.Violation
+	if errors.As(err, &v) {
+		http.Error(w, v.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, tx.ErrInsufficientFunds) || errors.Is(err, fee.ErrTooLow) || errors.Is(err, fee.ErrTooHigh) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("pst complete: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	raw, _ := json.Marshal(p)
+	if _, err := dbTx.Exec(ctx,
+		`UPDATE partial_transactions SET packet=$2, status='finalized', tx_id=$3::uuid, updated_at=NOW()
+         WHERE pst_id=$1`, req.PstID, raw, pending.TxID()); err != nil {
+		log.Printf("pst complete: mark %s finalized: %v", req.PstID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		log.Printf("pst complete: commit %s: %v", req.PstID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	resp, err := pending.Publish(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ✅ Get a partially signed transaction and its signing progress
+func DetailHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+	id := r.URL.Query().Get("pst_id")
+	if id == "" {
+		http.Error(w, "pst_id required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+	p, state, txID, err := load(ctx, dbTx, id)
+	if err != nil {
+		http.Error(w, "partial transaction not found", http.StatusNotFound)
+		return
+	}
+	// Only the uploader and the holders of a signer key may read the packet
+	var allowed bool
+	if err := dbTx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM partial_transactions WHERE pst_id=$1 AND user_id::text=$2)
+             OR EXISTS (SELECT 1 FROM wallets WHERE user_id::text=$2 AND public_key = ANY($3))`,
+		id, userID, p.Keys).Scan(&allowed); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "partial transaction not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status(id, p, state, txID))
+}
+
+// load reads and locks a stored packet.
+func load(ctx context.Context, q pgx.Tx, id string) (*Packet, string, string, error) {
+	var raw []byte
+	var state, txID string
+	err := q.QueryRow(ctx,
+		`SELECT packet, status, COALESCE(tx_id::text,'') FROM partial_transactions
+         WHERE pst_id=$1 FOR UPDATE`, id).Scan(&raw, &state, &txID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	var p Packet
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, "", "", err
+	}
+	return &p, state, txID, nil
+}
+
+// checkInputs makes sure the packet spends unspent UTXOs of the sender at the
+// amounts it claims, and that the sender wallet's key is among the signers.
+func checkInputs(ctx context.Context, q pgx.Tx, p *Packet) error {
+	var senderPub, keyType string
+	if err := q.QueryRow(ctx,
+		`SELECT public_key, key_type FROM wallets WHERE wallet_id=$1`, p.From).Scan(&senderPub, &keyType); err != nil {
+		return errors.New("invalid sender wallet")
+	}
+	if !slices.Contains(p.Keys, senderPub) {
+		return errors.New("signer keys must include the sender wallet's public key")
+	}
+	if p.KeyType(senderPub) != keyType {
+		return errors.New("sender key type does not match the wallet's " + keyType)
+	}
+	var recv string
+	if err := q.QueryRow(ctx,
+		`SELECT wallet_id FROM wallets WHERE wallet_id=$1`, p.To).Scan(&recv); err != nil {
+		return errors.New("invalid receiver wallet")
+	}
+
+	for _, in := range p.Inputs {
+		var amount int64
+		err := q.QueryRow(ctx,
+			`SELECT amount FROM utxos WHERE utxo_id=$1::uuid AND wallet_id=$2 AND spent=false`,
+			in.UTXOID, p.From).Scan(&amount)
+		if err != nil {
+			return tx.ErrInputsUnavailable
+		}
+		if amount != in.Amount {
+			return errors.New("input amount does not match UTXO " + in.UTXOID)
+		}
+	}
+	if p.InputTotal() < p.Amount+p.Fee {
+		return tx.ErrInsufficientFunds
+	}
+	return nil
+}
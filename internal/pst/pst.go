@@ -0,0 +1,266 @@
+// Package pst implements partially signed transactions: an interchange
+// format that carries an unsigned transfer together with the UTXOs it spends,
+// the public keys expected to sign it and the signatures collected so far.
+// Signers add their signature offline, packets signed by different parties
+// are combined, and a packet with enough signatures is finalized into a
+// tx.Transfer and submitted like any other send.
+//
+// Every key signs the same bytes, tx.CanonicalPayload of the transfer, so the
+// sender wallet's signature is also the one recorded on chain.
+package pst
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
+)
+
+const Version = 1
+
+var (
+	ErrMismatch     = errors.New("packets describe different transactions")
+	ErrUnknownKey   = errors.New("public key is not a signer of this transaction")
+	ErrBadSignature = errors.New("signature does not verify")
+	ErrIncomplete   = errors.New("not enough signatures")
+)
+
+// Input is a UTXO spent by the transaction.
+type Input struct {
+	UTXOID string `json:"utxo_id"`
+	Amount int64  `json:"amount"`
+}
+
+type Signature struct {
+	PublicKey string `json:"public_key"`
+	R         string `json:"r"`
+	S         string `json:"s"`
+}
+
+// Packet is a partially signed transaction.
+type Packet struct {
+	Version    int               `json:"version"`
+	From       string            `json:"from_wallet_id"`
+	To         string            `json:"to_wallet_id"`
+	Amount     int64             `json:"amount"`
+	Fee        int64             `json:"fee"` // 0 lets the server apply its fee policy
+	Timestamp  string            `json:"timestamp"`
+	Note       string            `json:"note"`
+	Inputs     []Input           `json:"inputs"`
+	Keys       []string          `json:"keys"`                // hex public keys; must include the sender wallet's key
+	KeyTypes   map[string]string `json:"key_types,omitempty"` // key type by public key, for keys that are not P-256
+	Threshold  int               `json:"threshold"`           // signatures required; 0 means all keys
+	Signatures []Signature       `json:"signatures"`
+}
+
+// Payload is the byte string every signer signs.
+func (p *Packet) Payload() []byte {
+	return []byte(tx.CanonicalPayload(p.From, p.To, p.Amount, p.Timestamp, p.Note))
+}
+
+// ID identifies the unsigned transaction: packets with the same ID can be
+// combined.
+func (p *Packet) ID() string {
+	unsigned := *p
+	unsigned.Signatures = nil
+	raw, _ := json.Marshal(unsigned)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Required is the number of signatures needed to finalize.
+func (p *Packet) Required() int {
+	if p.Threshold <= 0 || p.Threshold > len(p.Keys) {
+		return len(p.Keys)
+	}
+	return p.Threshold
+}
+
+// Validate checks the unsigned part is well formed.
+func (p *Packet) Validate() error {
+	switch {
+	case p.Version != Version:
+		return fmt.Errorf("unsupported version %d", p.Version)
+	case p.From == "" || p.To == "" || p.Amount <= 0 || p.Fee < 0 || p.Timestamp == "":
+		return errors.New("missing or invalid fields")
+	case len(p.Inputs) == 0:
+		return errors.New("no inputs")
+	case len(p.Keys) == 0:
+		return errors.New("no signer keys")
+	}
+	seen := map[string]bool{}
+	for _, in := range p.Inputs {
+		if in.UTXOID == "" || in.Amount <= 0 || seen[in.UTXOID] {
+			return fmt.Errorf("invalid input %q", in.UTXOID)
+		}
+		seen[in.UTXOID] = true
+	}
+	for _, k := range p.Keys {
+		if _, err := p.publicKey(k); err != nil || seen[k] {
+			return fmt.Errorf("invalid signer key %q", k)
+		}
+		seen[k] = true
+	}
+	for k := range p.KeyTypes {
+		if !slices.Contains(p.Keys, k) {
+			return fmt.Errorf("key type given for unknown key %q", k)
+		}
+	}
+	return nil
+}
+
+// KeyType is the declared type of a signer key.
+func (p *Packet) KeyType(pubHex string) string {
+	if kt := p.KeyTypes[pubHex]; kt != "" {
+		return kt
+	}
+	return crypto.KeyTypeP256
+}
+
+func (p *Packet) publicKey(pubHex string) (crypto.PublicKey, error) {
+	return crypto.ParsePublicKey(p.KeyType(pubHex), pubHex)
+}
+
+// InputTotal is the sum of the spent UTXOs.
+func (p *Packet) InputTotal() int64 {
+	var sum int64
+	for _, in := range p.Inputs {
+		sum += in.Amount
+	}
+	return sum
+}
+
+// AddSignature verifies and records a signature; an existing signature for
+// the same key is replaced.
+func (p *Packet) AddSignature(pubHex, rHex, sHex string) error {
+	if !slices.Contains(p.Keys, pubHex) {
+		return ErrUnknownKey
+	}
+	pub, err := p.publicKey(pubHex)
+	if err != nil {
+		return err
+	}
+	r, s, err := pub.ParseSignature("", rHex, sHex)
+	if err != nil {
+		return err
+	}
+	if !pub.Verify(p.Payload(), r, s) {
+		return ErrBadSignature
+	}
+	p.Signatures = slices.DeleteFunc(p.Signatures, func(sig Signature) bool { return sig.PublicKey == pubHex })
+	p.Signatures = append(p.Signatures, Signature{PublicKey: pubHex, R: r, S: s})
+	return nil
+}
+
+// Sign adds a signature made with priv.
+func (p *Packet) Sign(priv crypto.PrivateKey) error {
+	r, s, err := priv.Sign(p.Payload())
+	if err != nil {
+		return err
+	}
+	return p.AddSignature(priv.Public().Hex(), r, s)
+}
+
+// Combine merges the signatures of packets for the same transaction.
+// Signatures that do not verify are rejected.
+func Combine(packets ...*Packet) (*Packet, error) {
+	if len(packets) == 0 {
+		return nil, errors.New("nothing to combine")
+	}
+	out := *packets[0]
+	out.Signatures = nil
+	id := out.ID()
+	for _, p := range packets {
+		if p.ID() != id {
+			return nil, ErrMismatch
+		}
+		for _, sig := range p.Signatures {
+			if err := out.AddSignature(sig.PublicKey, sig.R, sig.S); err != nil {
+				return nil, fmt.Errorf("signature by %s: %w", sig.PublicKey, err)
+			}
+		}
+	}
+	return &out, nil
+}
+
+// Finalize checks that the packet is fully signed and returns the transfer
+// to submit. senderPub is the sender wallet's public key, whose signature
+// becomes the transaction signature. nonce is the idempotency key.
+func (p *Packet) Finalize(senderPub, nonce string) (tx.Transfer, error) {
+	if err := p.Validate(); err != nil {
+		return tx.Transfer{}, err
+	}
+	valid := 0
+	var senderSig *Signature
+	for i, sig := range p.Signatures {
+		pub, err := p.publicKey(sig.PublicKey)
+		if err != nil || !slices.Contains(p.Keys, sig.PublicKey) || !pub.Verify(p.Payload(), sig.R, sig.S) {
+			return tx.Transfer{}, fmt.Errorf("signature by %s: %w", sig.PublicKey, ErrBadSignature)
+		}
+		valid++
+		if sig.PublicKey == senderPub {
+			senderSig = &p.Signatures[i]
+		}
+	}
+	if valid < p.Required() {
+		return tx.Transfer{}, fmt.Errorf("%w: %d of %d", ErrIncomplete, valid, p.Required())
+	}
+	if senderSig == nil {
+		return tx.Transfer{}, fmt.Errorf("%w: missing the sender wallet's signature", ErrIncomplete)
+	}
+
+	inputs := make([]string, len(p.Inputs))
+	for i, in := range p.Inputs {
+		inputs[i] = in.UTXOID
+	}
+	return tx.Transfer{
+		FromWalletID:    p.From,
+		ToWalletID:      p.To,
+		Amount:          p.Amount,
+		Fee:             p.Fee,
+		Nonce:           nonce,
+		Timestamp:       p.Timestamp,
+		Note:            p.Note,
+		SenderPublicKey: senderSig.PublicKey,
+		SignatureR:      senderSig.R,
+		SignatureS:      senderSig.S,
+		Kind:            tx.KindTransfer,
+		Inputs:          inputs,
+	}, nil
+}
+
+// Encode serializes a packet as base64 JSON for transport.
+func (p *Packet) Encode() (string, error) {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// Decode parses an encoded packet and validates its unsigned part.
+func Decode(s string) (*Packet, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid packet encoding: %w", err)
+	}
+	var p Packet
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("invalid packet: %w", err)
+	}
+	// Signatures cover the payload with wallet IDs, so addresses are resolved first
+	if err := address.Normalize(&p.From, &p.To); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,285 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+type CreateRequest struct {
+	FromWalletID string `json:"from_wallet_id"`
+	ToWalletID   string `json:"to_wallet_id"`
+	Amount       int64  `json:"amount"`
+	Fee          int64  `json:"fee"`       // optional; 0 lets the server calculate per run
+	Interval     string `json:"interval"`  // daily | weekly | monthly
+	StartAt      string `json:"start_at"`  // RFC3339 in UTC, first due time; weekday/day-of-month anchor
+	MaxRuns      int    `json:"max_runs"`  // 0 = until cancelled
+	Timestamp    string `json:"timestamp"` // RFC3339 string (included in signed payload)
+	Note         string `json:"note"`
+	SignatureR   string `json:"signature_r"` // signature over tx.MandatePayload
+	SignatureS   string `json:"signature_s"`
+	Signature    string `json:"signature"` // optional instead of r/s: hex of 64-byte compact r||s, or DER for ECDSA
+}
+
+type MandateRequest struct {
+	MandateID string `json:"mandate_id"`
+}
+
+// ✅ Create a recurring payment mandate
+func CreateHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := address.Normalize(&req.FromWalletID, &req.ToWalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.FromWalletID == "" || req.ToWalletID == "" || req.Amount <= 0 || req.Timestamp == "" || req.MaxRuns < 0 {
+		http.Error(w, "missing or invalid fields", http.StatusBadRequest)
+		return
+	}
+	if req.FromWalletID == req.ToWalletID {
+		http.Error(w, "sender and recipient cannot be same", http.StatusBadRequest)
+		return
+	}
+	if !validInterval(req.Interval) {
+		http.Error(w, "interval must be daily, weekly or monthly", http.StatusBadRequest)
+		return
+	}
+	// start_at is signed as sent and re-derived from the stored time at block
+	// commit, so only the normalized UTC form is accepted.
+	startAt, err := time.Parse(time.RFC3339, req.StartAt)
+	if err != nil || startAt.UTC().Format(time.RFC3339) != req.StartAt {
+		http.Error(w, "start_at must be RFC3339 in UTC, e.g. 2026-01-02T09:00:00Z", http.StatusBadRequest)
+		return
+	}
+
+	if err := wallet.EnsureWalletOwnedByUser(dbPool, req.FromWalletID, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+
+	var senderPubHex, keyType string
+	if err := dbPool.QueryRow(ctx,
+		`SELECT public_key, key_type FROM wallets WHERE wallet_id=$1`, req.FromWalletID).
+		Scan(&senderPubHex, &keyType); err != nil {
+		http.Error(w, "invalid sender wallet", http.StatusBadRequest)
+		return
+	}
+	var recvID string
+	if err := dbPool.QueryRow(ctx,
+		`SELECT wallet_id FROM wallets WHERE wallet_id=$1`, req.ToWalletID).
+		Scan(&recvID); err != nil {
+		http.Error(w, "invalid receiver wallet", http.StatusBadRequest)
+		return
+	}
+
+	payload := tx.MandatePayload(req.FromWalletID, req.ToWalletID, req.Amount, req.Interval, req.StartAt, req.Timestamp, req.Note)
+	pubKey, err := crypto.ParsePublicKey(keyType, senderPubHex)
+	if err != nil {
+		http.Error(w, "invalid sender public key", http.StatusBadRequest)
+		return
+	}
+	sigR, sigS, err := pubKey.ParseSignature(req.Signature, req.SignatureR, req.SignatureS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !pubKey.Verify([]byte(payload), sigR, sigS) {
+		http.Error(w, "invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	var mandateID string
+	err = dbPool.QueryRow(ctx,
+		`INSERT INTO payment_mandates (
+            user_id, from_wallet_id, to_wallet_id, amount, fee, note, interval, start_at, max_runs,
+            next_run_at, sender_public_key, signature_r, signature_s, timestamp
+         )
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$8,$10,$11,$12,$13)
+         RETURNING mandate_id::text`,
+		userID, req.FromWalletID, req.ToWalletID, req.Amount, req.Fee, req.Note, req.Interval, startAt, req.MaxRuns,
+		senderPubHex, sigR, sigS, req.Timestamp).Scan(&mandateID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"mandate_id":  mandateID,
+		"status":      "active",
+		"next_run_at": startAt,
+	})
+}
+
+// ✅ List the authenticated user's mandates
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	rows, err := dbPool.Query(context.Background(),
+		`SELECT mandate_id::text, from_wallet_id, to_wallet_id, amount, fee, note, interval,
+                start_at, max_runs, runs, next_run_at, retries, COALESCE(last_error,''),
+                COALESCE(last_tx_id::text,''), status, signature_invalid, created_at
+         FROM payment_mandates WHERE user_id=$1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type M struct {
+		MandateID  string    `json:"mandate_id"`
+		From       string    `json:"from_wallet_id"`
+		To         string    `json:"to_wallet_id"`
+		Amount     int64     `json:"amount"`
+		Fee        int64     `json:"fee"`
+		Note       string    `json:"note"`
+		Interval   string    `json:"interval"`
+		StartAt    time.Time `json:"start_at"`
+		MaxRuns    int       `json:"max_runs"`
+		Runs       int       `json:"runs"`
+		NextRunAt  time.Time `json:"next_run_at"`
+		Retries    int       `json:"retries"`
+		LastError  string    `json:"last_error"`
+		LastTxID   string    `json:"last_tx_id"`
+		Status     string    `json:"status"`
+		SigInvalid bool      `json:"signature_invalid"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	var list []M
+	for rows.Next() {
+		var m M
+		if err := rows.Scan(&m.MandateID, &m.From, &m.To, &m.Amount, &m.Fee, &m.Note, &m.Interval,
+			&m.StartAt, &m.MaxRuns, &m.Runs, &m.NextRunAt, &m.Retries, &m.LastError,
+			&m.LastTxID, &m.Status, &m.SigInvalid, &m.CreatedAt); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		list = append(list, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"mandates": list})
+}
+
+// ✅ Pause an active mandate
+func PauseHandler(w http.ResponseWriter, r *http.Request) {
+	setStatus(w, r, "paused", `status='active'`)
+}
+
+// ✅ Resume a paused mandate; occurrences missed while paused are skipped
+func ResumeHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req MandateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MandateID == "" {
+		http.Error(w, "mandate_id required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	var interval, status string
+	var startAt time.Time
+	var runs int
+	var sigInvalid bool
+	err := dbPool.QueryRow(ctx,
+		`SELECT interval, start_at, runs, status, signature_invalid FROM payment_mandates
+         WHERE mandate_id=$1::uuid AND user_id=$2`, req.MandateID, userID).
+		Scan(&interval, &startAt, &runs, &status, &sigInvalid)
+	if err != nil {
+		http.Error(w, "mandate not found", http.StatusNotFound)
+		return
+	}
+	if status != "paused" {
+		http.Error(w, "mandate is not paused", http.StatusConflict)
+		return
+	}
+	if sigInvalid {
+		http.Error(w, errSignatureInvalid.Error()+"; create a new mandate", http.StatusConflict)
+		return
+	}
+
+	runs = nextDue(startAt, interval, runs, time.Now())
+	next := occurrence(startAt, interval, runs)
+	if _, err := dbPool.Exec(ctx,
+		`UPDATE payment_mandates SET status='active', runs=$2, retries=0, next_run_at=$3
+         WHERE mandate_id=$1::uuid`, req.MandateID, runs, next); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"mandate_id":  req.MandateID,
+		"status":      "active",
+		"next_run_at": next,
+	})
+}
+
+// ✅ Cancel a mandate permanently
+func CancelHandler(w http.ResponseWriter, r *http.Request) {
+	setStatus(w, r, "cancelled", `status IN ('active','paused')`)
+}
+
+func setStatus(w http.ResponseWriter, r *http.Request, status, fromCond string) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req MandateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MandateID == "" {
+		http.Error(w, "mandate_id required", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := dbPool.Exec(context.Background(),
+		`UPDATE payment_mandates SET status=$3
+         WHERE mandate_id=$1::uuid AND user_id=$2 AND `+fromCond,
+		req.MandateID, userID, status)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "mandate not found or not in a state that allows this", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"mandate_id": req.MandateID,
+		"status":     status,
+	})
+}
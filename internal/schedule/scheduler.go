@@ -0,0 +1,239 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/policy"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
+)
+
+var dbPool *pgxpool.Pool
+
+const (
+	maxRetries = 5         // attempts per occurrence that fails for lack of funds, inputs or fee
+	retryDelay = time.Hour // wait between those attempts
+)
+
+func Init(pool *pgxpool.Pool) {
+	dbPool = pool
+	go startScheduler()
+}
+
+func startScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		runDueMandates()
+	}
+}
+
+// occurrence returns the n-th due time of a mandate, counted from its start.
+// Computing from the anchor keeps monthly runs on the same day of month.
+func occurrence(start time.Time, interval string, n int) time.Time {
+	switch interval {
+	case "daily":
+		return start.AddDate(0, 0, n)
+	case "weekly":
+		return start.AddDate(0, 0, 7*n)
+	default:
+		return start.AddDate(0, n, 0)
+	}
+}
+
+// nextDue returns the first occurrence number from n on that is not yet due
+// at now. Occurrences missed in between, e.g. while the server was down, are
+// skipped rather than paid in a burst.
+func nextDue(start time.Time, interval string, n int, now time.Time) int {
+	for occurrence(start, interval, n).Before(now) {
+		n++
+	}
+	return n
+}
+
+func validInterval(interval string) bool {
+	return interval == "daily" || interval == "weekly" || interval == "monthly"
+}
+
+type mandate struct {
+	ID        string
+	From      string
+	To        string
+	Amount    int64
+	Fee       int64
+	Note      string
+	Interval  string
+	StartAt   time.Time
+	MaxRuns   int
+	Runs      int
+	Retries   int
+	PubKey    string
+	SigR      string
+	SigS      string
+	Timestamp string
+	Flagged   bool // signature_invalid
+}
+
+func runDueMandates() {
+	ctx := context.Background()
+
+	rows, err := dbPool.Query(ctx,
+		`SELECT mandate_id::text, from_wallet_id, to_wallet_id, amount, fee, note, interval,
+                start_at, max_runs, runs, retries, sender_public_key, signature_r, signature_s, timestamp,
+                signature_invalid
+         FROM payment_mandates
+         WHERE status='active' AND next_run_at <= NOW()
+         ORDER BY next_run_at ASC`)
+	if err != nil {
+		fmt.Println("schedule query mandates error:", err)
+		return
+	}
+	var due []mandate
+	for rows.Next() {
+		var m mandate
+		if err := rows.Scan(&m.ID, &m.From, &m.To, &m.Amount, &m.Fee, &m.Note, &m.Interval,
+			&m.StartAt, &m.MaxRuns, &m.Runs, &m.Retries, &m.PubKey, &m.SigR, &m.SigS, &m.Timestamp,
+			&m.Flagged); err != nil {
+			continue
+		}
+		due = append(due, m)
+	}
+	rows.Close()
+
+	for _, m := range due {
+		execute(ctx, m)
+	}
+}
+
+// errWalletUnusable means the payer or payee wallet was removed or retired.
+// The mandate can never run again as signed, so it is paused.
+var errWalletUnusable = errors.New("wallet removed or retired")
+
+// errSignatureInvalid means sigmigrate flagged the mandate's signature. No
+// transaction it authorizes would pass block commit.
+var errSignatureInvalid = errors.New("mandate signature is invalid")
+
+// permanent reports whether err fails the occurrence itself rather than the
+// attempt, so retrying on the next tick would fail the same way.
+func permanent(err error) bool {
+	var v *policy.Violation
+	return errors.As(err, &v) || errors.Is(err, tx.ErrInsufficientFunds) || errors.Is(err, tx.ErrInputsUnavailable) ||
+		errors.Is(err, fee.ErrTooLow) || errors.Is(err, fee.ErrTooHigh) || errors.Is(err, errWalletUnusable)
+}
+
+func usableWallets(ctx context.Context, m mandate) error {
+	var n int
+	if err := dbPool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM wallets WHERE wallet_id IN ($1,$2) AND retired_at IS NULL`,
+		m.From, m.To).Scan(&n); err != nil {
+		return err
+	}
+	if n < 2 {
+		return errWalletUnusable
+	}
+	return nil
+}
+
+func execute(ctx context.Context, m mandate) {
+	if m.Flagged {
+		pause(ctx, m, errSignatureInvalid)
+		return
+	}
+	var resp *tx.SendResponse
+	err := usableWallets(ctx, m)
+	if err == nil {
+		resp, err = tx.Submit(ctx, tx.Transfer{
+			FromWalletID:    m.From,
+			ToWalletID:      m.To,
+			Amount:          m.Amount,
+			Fee:             m.Fee,
+			Nonce:           fmt.Sprintf("mandate-%s-%d", m.ID, m.Runs),
+			Timestamp:       time.Now().UTC().Format(time.RFC3339),
+			Note:            m.Note,
+			SenderPublicKey: m.PubKey,
+			SignatureR:      m.SigR,
+			SignatureS:      m.SigS,
+			MandateID:       m.ID,
+		})
+	}
+
+	switch {
+	case err == nil:
+	case !permanent(err):
+		// Transient failure: leave the occurrence due so the next tick retries it.
+		fmt.Println("schedule execute mandate error:", err)
+		_, _ = dbPool.Exec(ctx,
+			`UPDATE payment_mandates SET last_error=$2 WHERE mandate_id=$1`, m.ID, err.Error())
+		return
+	case !errors.Is(err, errWalletUnusable) && m.Retries < maxRetries:
+		_, _ = dbPool.Exec(ctx,
+			`UPDATE payment_mandates SET retries=retries+1, last_error=$2, next_run_at=$3 WHERE mandate_id=$1`,
+			m.ID, err.Error(), time.Now().Add(retryDelay))
+		return
+	case !errors.Is(err, tx.ErrInsufficientFunds):
+		// Later occurrences would fail the same way; the owner has to fix the
+		// cause and resume.
+		pause(ctx, m, err)
+		return
+	}
+
+	// Occurrence is done: either paid or skipped after exhausting retries.
+	// Others that fell due meanwhile are skipped, as on resume.
+	runs := nextDue(m.StartAt, m.Interval, m.Runs+1, time.Now())
+	missed := runs - m.Runs - 1
+	status := "active"
+	if m.MaxRuns > 0 && runs >= m.MaxRuns {
+		status = "completed"
+	}
+	var lastErr, lastTx any
+	if err != nil {
+		lastErr = fmt.Sprintf("occurrence %d skipped: %v", m.Runs, err)
+	} else {
+		lastTx = resp.TxID
+	}
+	_, uerr := dbPool.Exec(ctx,
+		`UPDATE payment_mandates
+         SET runs=$2, retries=0, next_run_at=$3, status=$4, last_error=$5,
+             last_tx_id=COALESCE($6::uuid, last_tx_id)
+         WHERE mandate_id=$1`,
+		m.ID, runs, occurrence(m.StartAt, m.Interval, runs), status, lastErr, lastTx)
+	if uerr != nil {
+		fmt.Println("schedule update mandate error:", uerr)
+		return
+	}
+
+	msg := fmt.Sprintf("Mandate %s paid %d to wallet %s", m.ID, m.Amount, m.To)
+	meta := fmt.Sprintf(`{"mandate_id":"%s","occurrence":%d,"tx_id":"%v"}`, m.ID, m.Runs, lastTx)
+	if err != nil {
+		msg = fmt.Sprintf("Mandate %s skipped occurrence %d: insufficient funds", m.ID, m.Runs)
+	}
+	logEvent(ctx, msg, meta)
+	if missed > 0 {
+		logEvent(ctx, fmt.Sprintf("Mandate %s skipped %d missed occurrences", m.ID, missed),
+			fmt.Sprintf(`{"mandate_id":"%s","from_occurrence":%d,"skipped":%d}`, m.ID, m.Runs+1, missed))
+	}
+}
+
+func pause(ctx context.Context, m mandate, cause error) {
+	reason := fmt.Sprintf("paused at occurrence %d: %v", m.Runs, cause)
+	if _, err := dbPool.Exec(ctx,
+		`UPDATE payment_mandates SET status='paused', retries=0, last_error=$2
+         WHERE mandate_id=$1 AND status='active'`, m.ID, reason); err != nil {
+		fmt.Println("schedule pause mandate error:", err)
+		return
+	}
+	logEvent(ctx, fmt.Sprintf("Mandate %s %s", m.ID, reason),
+		fmt.Sprintf(`{"mandate_id":"%s","occurrence":%d}`, m.ID, m.Runs))
+}
+
+func logEvent(ctx context.Context, msg, meta string) {
+	_, _ = dbPool.Exec(ctx,
+		`INSERT INTO system_logs (id, type, message, metadata, timestamp)
+         VALUES (gen_random_uuid(),'schedule',$1,$2,NOW())`,
+		msg, meta)
+}
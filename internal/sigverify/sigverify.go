@@ -0,0 +1,168 @@
+// Package sigverify checks transaction signatures in bulk. Signatures are
+// verified concurrently across a worker pool, and every signature that
+// verifies is remembered by hash so the same transaction is not verified
+// again at commit, on the next validation run, and so on.
+package sigverify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime"
+	"sync"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+)
+
+// Job is one signature to check.
+type Job struct {
+	ID      string // transaction ID, only used for reporting
+	KeyType string // wallets.key_type of PubKey; empty means P-256
+	PubKey  string // hex public key the signature must verify under
+	Payload []byte // the signed bytes
+	R, S    string // signature halves as hex
+}
+
+// Hash identifies a verification: the same key, payload and signature always
+// give the same answer, so a cached hash can stand in for the verification.
+func (j Job) Hash() string {
+	h := sha256.New()
+	for _, part := range []string{j.KeyType, j.PubKey, j.R, j.S} {
+		h.Write([]byte(part))
+		h.Write([]byte{'|'})
+	}
+	h.Write(j.Payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type Result struct {
+	ID     string `json:"tx_id"`
+	Valid  bool   `json:"valid"`
+	Cached bool   `json:"cached"`
+}
+
+// Cache is a bounded set of verified job hashes. When full, the oldest entry
+// is evicted first.
+type Cache struct {
+	mu    sync.Mutex
+	max   int
+	set   map[string]struct{}
+	order []string
+	next  int
+}
+
+func NewCache(max int) *Cache {
+	if max <= 0 {
+		max = 1
+	}
+	return &Cache{max: max, set: make(map[string]struct{}, max)}
+}
+
+func (c *Cache) Has(hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.set[hash]
+	return ok
+}
+
+func (c *Cache) Add(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.set[hash]; ok {
+		return
+	}
+	if len(c.order) < c.max {
+		c.order = append(c.order, hash)
+	} else {
+		delete(c.set, c.order[c.next])
+		c.order[c.next] = hash
+		c.next = (c.next + 1) % c.max
+	}
+	c.set[hash] = struct{}{}
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.set)
+}
+
+// Verifier checks jobs on Workers goroutines, consulting Cache first.
+type Verifier struct {
+	Workers int
+	Cache   *Cache
+}
+
+func New(workers, cacheSize int) *Verifier {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Verifier{Workers: workers, Cache: NewCache(cacheSize)}
+}
+
+// Default is the verifier shared by commit and chain validation.
+var Default = New(runtime.NumCPU(), 100000)
+
+// Verify checks a single job.
+func (v *Verifier) Verify(j Job) Result {
+	res := Result{ID: j.ID}
+	if j.PubKey == "" || j.R == "" || j.S == "" || len(j.Payload) == 0 {
+		return res
+	}
+	hash := j.Hash()
+	if v.Cache != nil && v.Cache.Has(hash) {
+		res.Valid, res.Cached = true, true
+		return res
+	}
+	pub, err := crypto.ParsePublicKey(j.KeyType, j.PubKey)
+	if err != nil {
+		return res
+	}
+	res.Valid = pub.Verify(j.Payload, j.R, j.S)
+	if res.Valid && v.Cache != nil {
+		v.Cache.Add(hash)
+	}
+	return res
+}
+
+// VerifyBatch checks all jobs concurrently. Results are in job order. If ctx
+// is cancelled the remaining jobs are left unverified (Valid=false) and the
+// context error is returned.
+func (v *Verifier) VerifyBatch(ctx context.Context, jobs []Job) ([]Result, error) {
+	results := make([]Result, len(jobs))
+	workers := min(max(v.Workers, 1), len(jobs))
+
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				results[i] = v.Verify(jobs[i])
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := range jobs {
+		select {
+		case idx <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(idx)
+	wg.Wait()
+
+	if err != nil {
+		for i := range results {
+			if results[i].ID == "" {
+				results[i].ID = jobs[i].ID
+			}
+		}
+	}
+	return results, err
+}
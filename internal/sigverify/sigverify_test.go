@@ -0,0 +1,101 @@
+package sigverify
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+)
+
+const (
+	benchJobs = 1000
+	benchKeys = 50
+)
+
+// BenchmarkVerifyBatch measures one block of signatures: sequential
+// verification, the worker pool at several sizes with a cold cache, and a
+// re-run against a warm cache.
+func BenchmarkVerifyBatch(b *testing.B) {
+	jobs := makeJobs(b, benchJobs, benchKeys)
+
+	b.Run("sequential", func(b *testing.B) {
+		v := New(1, 0)
+		for b.Loop() {
+			v.Cache = nil
+			for _, j := range jobs {
+				if !v.Verify(j).Valid {
+					b.Fatal("invalid signature")
+				}
+			}
+		}
+	})
+
+	counts := []int{1, 2, 4}
+	if n := runtime.NumCPU(); !slices.Contains(counts, n) {
+		counts = append(counts, n)
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d/cold", workers), func(b *testing.B) {
+			for b.Loop() {
+				verifyAll(b, New(workers, len(jobs)), jobs)
+			}
+		})
+	}
+
+	b.Run("warm", func(b *testing.B) {
+		v := New(runtime.NumCPU(), len(jobs))
+		verifyAll(b, v, jobs)
+		for b.Loop() {
+			verifyAll(b, v, jobs)
+		}
+	})
+}
+
+func verifyAll(b *testing.B, v *Verifier, jobs []Job) {
+	results, err := v.VerifyBatch(context.Background(), jobs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.Valid {
+			b.Fatal("invalid signature")
+		}
+	}
+}
+
+// makeJobs signs n transfers from a handful of wallets, as in a real block.
+func makeJobs(b *testing.B, n, keys int) []Job {
+	type signer struct {
+		pubHex string
+		sign   func([]byte) (string, string, error)
+	}
+	signers := make([]signer, max(keys, 1))
+	for i := range signers {
+		priv, pub, err := crypto.GenerateKeypair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		signers[i] = signer{
+			pubHex: crypto.SerializePublicKey(pub),
+			sign:   func(p []byte) (string, string, error) { return crypto.SignPayload(priv, p) },
+		}
+	}
+
+	ts := time.Now().UTC().Format(time.RFC3339)
+	jobs := make([]Job, n)
+	for i := range jobs {
+		s := signers[i%len(signers)]
+		payload := fmt.Appendf(nil, "wallet-%d|merchant|%d|%s|", i%len(signers), i+1, ts)
+		r, sig, err := s.sign(payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		jobs[i] = Job{ID: strconv.Itoa(i), PubKey: s.pubHex, Payload: payload, R: r, S: sig}
+	}
+	return jobs
+}
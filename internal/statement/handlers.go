@@ -0,0 +1,197 @@
+package statement
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+// maxRange bounds one statement, so a request cannot read a wallet's whole
+// history at once.
+const maxRange = 366 * 24 * time.Hour
+
+var csvHeader = []string{
+	"wallet_id", "address", "time", "tx_id", "kind", "status", "counterparty", "counterparty_name",
+	"note", "credit", "debit", "fee", "balance",
+}
+
+// ✅ Download a statement (GET ?wallet_id=&month=YYYY-MM or &from=&to=, &format=json|csv)
+//
+// Without wallet_id the statement covers every wallet the user owns. from is
+// inclusive and to exclusive, each a date or RFC3339 time in UTC; the default
+// is the current month.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	walletID, err := address.FromQuery(r, "wallet_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	var statements []*Statement
+	var body any
+	name := userID
+	if walletID != "" {
+		// Owners and watchers may read
+		_, err := wallet.EnsureWalletReadableByUser(dbPool, walletID, userID)
+		if errors.Is(err, wallet.ErrWalletNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		s, err := Generate(ctx, walletID, from, to)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		statements, body, name = []*Statement{s}, s, walletID
+	} else {
+		us, err := GenerateForUser(ctx, userID, from, to)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		statements, body = us.Wallets, us
+	}
+	if err := nameCounterparties(ctx, userID, statements); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "statement-" + name + "-" + from.Format(time.DateOnly) + "-" + to.Format(time.DateOnly) + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	writeCSV(w, statements)
+}
+
+// parseRange reads month, or from and to, defaulting to the current month.
+func parseRange(r *http.Request) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	if m := q.Get("month"); m != "" {
+		from, err := time.Parse("2006-01", m)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("month must be YYYY-MM")
+		}
+		return from, from.AddDate(0, 1, 0), nil
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = parseTime(v); err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be YYYY-MM-DD or RFC3339")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parseTime(v); err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be YYYY-MM-DD or RFC3339")
+		}
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	if to.Sub(from) > maxRange {
+		return time.Time{}, time.Time{}, errors.New("range is limited to 366 days")
+	}
+	return from, to, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t.UTC(), err
+}
+
+// nameCounterparties fills in counterparty names from the user's contacts
+// and wallet labels.
+func nameCounterparties(ctx context.Context, userID string, statements []*Statement) error {
+	var ids []string
+	for _, s := range statements {
+		for _, it := range s.Items {
+			if it.Counterparty != "" {
+				ids = append(ids, it.Counterparty)
+			}
+		}
+	}
+	names, err := wallet.CounterpartyNames(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for _, s := range statements {
+		for i := range s.Items {
+			s.Items[i].CounterpartyName = names[s.Items[i].Counterparty]
+		}
+	}
+	return nil
+}
+
+// writeCSV writes one table for all statements. Each wallet's items sit
+// between an opening row with the opening balance and a closing row with the
+// period's totals and closing balance.
+func writeCSV(w http.ResponseWriter, statements []*Statement) {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	amount := func(v int64) string { return strconv.FormatInt(v, 10) }
+	for _, s := range statements {
+		cw.Write([]string{s.WalletID, s.Address, s.From.Format(time.RFC3339), "", "opening", "", "", "", "",
+			"", "", "", amount(s.OpeningBalance)})
+		for _, it := range s.Items {
+			cw.Write([]string{s.WalletID, s.Address, it.Time.UTC().Format(time.RFC3339), it.TxID, it.Kind, it.Status,
+				it.Counterparty, textCell(it.CounterpartyName), textCell(it.Note),
+				amount(it.Credit), amount(it.Debit), amount(it.Fee), amount(it.Balance)})
+		}
+		cw.Write([]string{s.WalletID, s.Address, s.To.Format(time.RFC3339), "", "closing", "", "", "", "",
+			amount(s.TotalCredits), amount(s.TotalDebits), amount(s.TotalFees), amount(s.ClosingBalance)})
+	}
+	cw.Flush()
+}
+
+// textCell quotes user-written text that a spreadsheet would otherwise run as
+// a formula when the statement is opened.
+func textCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
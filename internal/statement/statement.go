@@ -0,0 +1,191 @@
+// Package statement builds wallet account statements for a date range from
+// transactions and their outputs: the opening balance, each credit and debit
+// with its fee, and the closing balance.
+package statement
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+var dbPool *pgxpool.Pool
+
+func Init(pool *pgxpool.Pool) { dbPool = pool }
+
+// KindGenesis marks an item for coins a wallet was created with, which have
+// no transaction.
+const KindGenesis = "genesis"
+
+// dropped transactions never moved funds and are left out of statements.
+var dropped = []string{tx.StatusRejected, tx.StatusExpired, tx.StatusReplaced}
+
+// Item is one transaction as seen from the statement's wallet. A transfer
+// from the wallet debits what went to other wallets and the fee; change back
+// to the wallet is neither a credit nor a debit.
+type Item struct {
+	Time             time.Time `json:"time"`
+	TxID             string    `json:"tx_id,omitempty"`
+	Kind             string    `json:"kind"` // transfer, system or genesis
+	Status           string    `json:"status"`
+	Counterparty     string    `json:"counterparty,omitempty"`
+	CounterpartyName string    `json:"counterparty_name,omitempty"`
+	Note             string    `json:"note,omitempty"`
+	Credit           int64     `json:"credit"`
+	Debit            int64     `json:"debit"`
+	Fee              int64     `json:"fee"`
+	Balance          int64     `json:"balance"` // after this item
+}
+
+// Statement covers [From, To) for one wallet. Pending transactions are
+// included, as they are in the wallet's total balance.
+type Statement struct {
+	WalletID       string    `json:"wallet_id"`
+	Address        string    `json:"address"`
+	Label          string    `json:"label"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	OpeningBalance int64     `json:"opening_balance"`
+	TotalCredits   int64     `json:"total_credits"`
+	TotalDebits    int64     `json:"total_debits"`
+	TotalFees      int64     `json:"total_fees"`
+	ClosingBalance int64     `json:"closing_balance"`
+	Items          []Item    `json:"items"`
+}
+
+// UserStatement is a statement for each of a user's wallets with their sums.
+// Transfers between the user's own wallets count on both sides.
+type UserStatement struct {
+	UserID         string       `json:"user_id"`
+	From           time.Time    `json:"from"`
+	To             time.Time    `json:"to"`
+	OpeningBalance int64        `json:"opening_balance"`
+	TotalCredits   int64        `json:"total_credits"`
+	TotalDebits    int64        `json:"total_debits"`
+	TotalFees      int64        `json:"total_fees"`
+	ClosingBalance int64        `json:"closing_balance"`
+	Wallets        []*Statement `json:"wallets"`
+}
+
+// Generate builds the statement of walletID for [from, to).
+func Generate(ctx context.Context, walletID string, from, to time.Time) (*Statement, error) {
+	s := &Statement{WalletID: walletID, Address: address.For(walletID), From: from, To: to, Items: []Item{}}
+	err := dbPool.QueryRow(ctx, `SELECT label FROM wallets WHERE wallet_id=$1`, walletID).Scan(&s.Label)
+	if err != nil {
+		return nil, wallet.ErrWalletNotFound
+	}
+
+	// Received from others, less sent to others and fees, plus genesis coins.
+	err = dbPool.QueryRow(ctx,
+		`SELECT COALESCE((SELECT SUM(o.amount) FROM transaction_outputs o
+                          JOIN transactions t ON t.tx_id = o.tx_id
+                          WHERE o.wallet_id=$1 AND t.from_wallet_id<>$1
+                            AND t.created_at < $2 AND t.status <> ALL($3)), 0)
+              - COALESCE((SELECT SUM(o.amount) FROM transaction_outputs o
+                          JOIN transactions t ON t.tx_id = o.tx_id
+                          WHERE t.from_wallet_id=$1 AND o.wallet_id<>$1
+                            AND t.created_at < $2 AND t.status <> ALL($3)), 0)
+              - COALESCE((SELECT SUM(fee) FROM transactions
+                          WHERE from_wallet_id=$1 AND created_at < $2 AND status <> ALL($3)), 0)
+              + COALESCE((SELECT SUM(amount) FROM utxos
+                          WHERE wallet_id=$1 AND tx_id IS NULL AND created_at < $2), 0)`,
+		walletID, from, dropped).Scan(&s.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dbPool.Query(ctx,
+		`SELECT t.tx_id::text, t.kind, t.status, t.from_wallet_id, t.to_wallet_id, COALESCE(t.note, ''),
+                t.created_at, t.fee,
+                COALESCE(SUM(o.amount) FILTER (WHERE o.wallet_id = $1), 0),
+                COALESCE(SUM(o.amount) FILTER (WHERE o.wallet_id <> $1), 0)
+         FROM transactions t
+         JOIN transaction_outputs o ON o.tx_id = t.tx_id
+         WHERE (t.from_wallet_id = $1
+                OR EXISTS (SELECT 1 FROM transaction_outputs m WHERE m.tx_id = t.tx_id AND m.wallet_id = $1))
+           AND t.created_at >= $2 AND t.created_at < $3 AND t.status <> ALL($4)
+         GROUP BY t.tx_id
+         UNION ALL
+         SELECT '', $5::text, $6::text, '', $1, '', created_at, 0, amount, 0
+         FROM utxos
+         WHERE wallet_id=$1 AND tx_id IS NULL AND created_at >= $2 AND created_at < $3
+         ORDER BY 7, 1`,
+		walletID, from, to, dropped, KindGenesis, tx.StatusConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balance := s.OpeningBalance
+	for rows.Next() {
+		var it Item
+		var fromID, toID string
+		var received, sent, fee int64
+		if err := rows.Scan(&it.TxID, &it.Kind, &it.Status, &fromID, &toID, &it.Note,
+			&it.Time, &fee, &received, &sent); err != nil {
+			return nil, err
+		}
+		if fromID == walletID {
+			it.Debit, it.Fee = sent, fee
+		} else {
+			it.Credit = received
+		}
+		if it.Kind != KindGenesis {
+			it.Counterparty = wallet.Counterparty(walletID, fromID, toID)
+		}
+		balance += it.Credit - it.Debit - it.Fee
+		it.Balance = balance
+		s.TotalCredits += it.Credit
+		s.TotalDebits += it.Debit
+		s.TotalFees += it.Fee
+		s.Items = append(s.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.ClosingBalance = balance
+	return s, nil
+}
+
+// GenerateForUser builds statements for every wallet userID owns, including
+// retired ones, which still have history. Watched wallets are left out.
+func GenerateForUser(ctx context.Context, userID string, from, to time.Time) (*UserStatement, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT wallet_id FROM wallets WHERE user_id=$1 ORDER BY is_default DESC, created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	us := &UserStatement{UserID: userID, From: from, To: to, Wallets: []*Statement{}}
+	for _, id := range ids {
+		s, err := Generate(ctx, id, from, to)
+		if err != nil {
+			return nil, err
+		}
+		us.OpeningBalance += s.OpeningBalance
+		us.TotalCredits += s.TotalCredits
+		us.TotalDebits += s.TotalDebits
+		us.TotalFees += s.TotalFees
+		us.ClosingBalance += s.ClosingBalance
+		us.Wallets = append(us.Wallets, s)
+	}
+	return us, nil
+}
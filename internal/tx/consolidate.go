@@ -0,0 +1,202 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/mempool"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+// ConsolidateRequest is sent twice: first without a signature to get a
+// preview and the payload to sign, then with the preview's inputs, fee and
+// timestamp plus the signature to submit the self-transfer.
+type ConsolidateRequest struct {
+	WalletID    string `json:"wallet_id"`
+	BelowAmount int64  `json:"below_amount"` // sweep UTXOs smaller than this; default 100× the dust limit
+	MaxInputs   int    `json:"max_inputs"`   // default 100
+
+	Inputs     []string `json:"inputs"`
+	Fee        int64    `json:"fee"`
+	Timestamp  string   `json:"timestamp"`
+	Nonce      string   `json:"nonce"`
+	SignatureR string   `json:"signature_r"`
+	SignatureS string   `json:"signature_s"`
+	Signature  string   `json:"signature"` // optional instead of r/s: hex of DER or 64-byte compact r||s
+}
+
+const consolidateNote = "consolidate"
+
+// ✅ Sweep a wallet's small UTXOs into one output with a signed self-transfer
+func ConsolidateHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req ConsolidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WalletID == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := address.Normalize(&req.WalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := wallet.EnsureWalletOwnedByUser(dbPool, req.WalletID, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if req.SignatureR == "" && req.SignatureS == "" && req.Signature == "" {
+		consolidatePreview(w, req)
+		return
+	}
+
+	if len(req.Inputs) < 2 || req.Fee <= 0 || req.Timestamp == "" || req.Nonce == "" {
+		http.Error(w, "missing or invalid fields", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	var senderPubHex, keyType string
+	var sum int64
+	var found int
+	if err := dbPool.QueryRow(ctx,
+		`SELECT w.public_key, w.key_type, COALESCE(SUM(u.amount),0), COUNT(u.utxo_id)
+         FROM wallets w
+         LEFT JOIN utxos u ON u.wallet_id = w.wallet_id AND u.spent=false AND u.utxo_id = ANY($2::uuid[])
+         WHERE w.wallet_id=$1
+         GROUP BY w.public_key, w.key_type`, req.WalletID, req.Inputs).
+		Scan(&senderPubHex, &keyType, &sum, &found); err != nil {
+		http.Error(w, "invalid wallet", http.StatusBadRequest)
+		return
+	}
+	if found != len(req.Inputs) {
+		http.Error(w, ErrInputsUnavailable.Error(), http.StatusConflict)
+		return
+	}
+	amount := sum - req.Fee
+	if amount <= 0 {
+		http.Error(w, "fee exceeds inputs", http.StatusBadRequest)
+		return
+	}
+
+	payload := CanonicalPayload(req.WalletID, req.WalletID, amount, req.Timestamp, consolidateNote)
+	pubKey, err := crypto.ParsePublicKey(keyType, senderPubHex)
+	if err != nil {
+		http.Error(w, "invalid sender public key", http.StatusBadRequest)
+		return
+	}
+	sigR, sigS, err := pubKey.ParseSignature(req.Signature, req.SignatureR, req.SignatureS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !pubKey.Verify([]byte(payload), sigR, sigS) {
+		http.Error(w, "invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := Submit(ctx, Transfer{
+		FromWalletID:    req.WalletID,
+		ToWalletID:      req.WalletID,
+		Amount:          amount,
+		Fee:             req.Fee,
+		Nonce:           req.Nonce,
+		Timestamp:       req.Timestamp,
+		Note:            consolidateNote,
+		SenderPublicKey: senderPubHex,
+		SignatureR:      sigR,
+		SignatureS:      sigS,
+		Inputs:          req.Inputs,
+	})
+	if errors.Is(err, ErrInputsUnavailable) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, ErrInsufficientFunds) || errors.Is(err, fee.ErrTooLow) || errors.Is(err, fee.ErrTooHigh) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("consolidate: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func consolidatePreview(w http.ResponseWriter, req ConsolidateRequest) {
+	policy := fee.Current()
+	if req.BelowAmount <= 0 {
+		req.BelowAmount = 100 * max(policy.DustLimit, 1)
+	}
+	if req.MaxInputs <= 0 {
+		req.MaxInputs = 100
+	}
+
+	ctx := context.Background()
+	rows, err := dbPool.Query(ctx,
+		`SELECT utxo_id::text, amount FROM utxos
+         WHERE wallet_id=$1 AND spent=false AND amount < $2
+         ORDER BY amount ASC LIMIT $3`, req.WalletID, req.BelowAmount, req.MaxInputs)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	var inputs []string
+	var sum int64
+	for rows.Next() {
+		var id string
+		var amt int64
+		if err := rows.Scan(&id, &amt); err != nil {
+			rows.Close()
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		inputs = append(inputs, id)
+		sum += amt
+	}
+	rows.Close()
+	if len(inputs) < 2 {
+		http.Error(w, "fewer than two small UTXOs; nothing to consolidate", http.StatusBadRequest)
+		return
+	}
+
+	tier := "standard"
+	_ = dbPool.QueryRow(ctx, `SELECT tier FROM wallets WHERE wallet_id=$1`, req.WalletID).Scan(&tier)
+	// Fee is computed on the full input total, which bounds the fee on the swept amount.
+	txFee := policy.Required(fee.Params{Size: mempool.EstimateSize(len(inputs), 2), Amount: sum, Tier: tier})
+	amount := sum - txFee
+	if amount <= 0 || policy.IsDust(amount) {
+		http.Error(w, "small UTXOs do not cover the consolidation fee", http.StatusBadRequest)
+		return
+	}
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"wallet_id":   req.WalletID,
+		"address":     address.For(req.WalletID),
+		"inputs":      inputs,
+		"input_total": sum,
+		"fee":         txFee,
+		"amount":      amount,
+		"timestamp":   timestamp,
+		"note":        consolidateNote,
+		"payload":     CanonicalPayload(req.WalletID, req.WalletID, amount, timestamp, consolidateNote),
+	})
+}
@@ -0,0 +1,174 @@
+package tx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/audit"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/kms"
+)
+
+var (
+	errClientCustody = errors.New("wallet key is held by the client; sign with /tx/send")
+	errLegacyKey     = errors.New("wallet key must be migrated with rekey first")
+	errAudit         = errors.New("audit error")
+	errReauth        = errors.New("re-authentication required: request a custodial_send OTP from /auth/reauth")
+)
+
+// CustodialSendRequest is a SendRequest without the signature fields; the
+// server sets the timestamp and signs.
+type CustodialSendRequest struct {
+	FromWalletID  string   `json:"from_wallet_id"` // optional; the user's default wallet when empty
+	ToWalletID    string   `json:"to_wallet_id"`
+	ToContact     string   `json:"to_contact"`
+	Amount        int64    `json:"amount"`
+	Fee           int64    `json:"fee"`
+	Nonce         string   `json:"nonce"`
+	Note          string   `json:"note"`
+	InvoiceID     string   `json:"invoice_id"`
+	AllowRetired  bool     `json:"allow_retired"`
+	ConfirmedOnly bool     `json:"confirmed_only"`
+	OverrideOTP   string   `json:"override_otp"`
+	Inputs        []string `json:"inputs"`
+	Passphrase    string   `json:"passphrase"` // unlocks passphrase-wrapped keys
+	ReauthOTP     string   `json:"reauth_otp"` // custodial_send OTP from /auth/reauth; required for master-wrapped keys
+}
+
+// ✅ Send from a custodial wallet; the server unlocks the key and signs
+func CustodialSendHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req CustodialSendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	sreq := SendRequest{
+		FromWalletID:  req.FromWalletID,
+		ToWalletID:    req.ToWalletID,
+		ToContact:     req.ToContact,
+		Amount:        req.Amount,
+		Fee:           req.Fee,
+		Nonce:         req.Nonce,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		Note:          req.Note,
+		InvoiceID:     req.InvoiceID,
+		AllowRetired:  req.AllowRetired,
+		ConfirmedOnly: req.ConfirmedOnly,
+		OverrideOTP:   req.OverrideOTP,
+		Inputs:        req.Inputs,
+	}
+	send(w, r, userID, sreq, custodialSigner(r, userID, req.Passphrase, req.ReauthOTP))
+}
+
+// custodialSigner unlocks the sender's stored key and signs with it. A
+// master-wrapped key opens without the user, so the user must re-authenticate
+// with an OTP instead; a bearer token alone is not enough. Every attempt is
+// audited, and no signature is released unless its audit record was written.
+func custodialSigner(r *http.Request, userID, passphrase, otp string) signFunc {
+	return func(ctx context.Context, req SendRequest, pub crypto.PublicKey, payload string) (string, string, error) {
+		sum := sha256.Sum256([]byte(payload))
+		ev := audit.Event{
+			Action: "tx.custodial_sign", UserID: userID, WalletID: req.FromWalletID, RemoteIP: audit.RemoteIP(r),
+			Details: map[string]any{
+				"to_wallet_id": req.ToWalletID,
+				"amount":       req.Amount,
+				"nonce":        req.Nonce,
+				"payload_hash": hex.EncodeToString(sum[:]),
+			},
+		}
+		fail := func(outcome string, err error) (string, string, error) {
+			ev.Outcome, ev.Reason = outcome, err.Error()
+			if aerr := audit.Record(ctx, ev); aerr != nil {
+				log.Printf("audit: %v", aerr)
+			}
+			return "", "", err
+		}
+
+		var encPriv *string
+		if err := dbPool.QueryRow(ctx,
+			`SELECT private_key_enc FROM wallets WHERE wallet_id=$1`, req.FromWalletID).Scan(&encPriv); err != nil {
+			return fail(audit.Failed, err)
+		}
+		if encPriv == nil {
+			return fail(audit.Denied, errClientCustody)
+		}
+		env, err := envelope.Parse(*encPriv)
+		if errors.Is(err, envelope.ErrNotEnvelope) {
+			return fail(audit.Denied, errLegacyKey)
+		}
+		if err != nil {
+			return fail(audit.Failed, err)
+		}
+		if env.Wrap == envelope.WrapMaster {
+			if otp == "" {
+				return fail(audit.Denied, errReauth)
+			}
+			err := auth.ConsumeOTP(ctx, userID, auth.PurposeCustodialSend, otp)
+			if errors.Is(err, auth.ErrInvalidOTP) || errors.Is(err, auth.ErrOTPLocked) {
+				return fail(audit.Denied, err)
+			}
+			if err != nil {
+				return fail(audit.Failed, err)
+			}
+		}
+		// The key manager opens the key and signs; the key never reaches this code
+		sigR, sigS, err := kms.Sign(ctx, kms.SignRequest{
+			KeyType:    pub.KeyType(),
+			PublicKey:  pub.Hex(),
+			Envelope:   *encPriv,
+			Passphrase: passphrase,
+			Payload:    []byte(payload),
+		})
+		switch {
+		case errors.Is(err, envelope.ErrNotEnvelope):
+			return fail(audit.Denied, errLegacyKey)
+		case errors.Is(err, kms.ErrKeyMismatch):
+			return fail(audit.Failed, err)
+		case err != nil:
+			return fail(audit.Denied, err)
+		}
+
+		ev.Outcome = audit.Success
+		if err := audit.Record(ctx, ev); err != nil {
+			log.Printf("audit: %v", err)
+			return "", "", errAudit
+		}
+		return sigR, sigS, nil
+	}
+}
+
+// writeSignError maps server-side signing failures to responses.
+func writeSignError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, envelope.ErrWrongPassphrase), errors.Is(err, errReauth), errors.Is(err, auth.ErrInvalidOTP):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrOTPLocked):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, errClientCustody), errors.Is(err, errLegacyKey):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, envelope.ErrNoMasterKey), errors.Is(err, envelope.ErrWrongMasterKey):
+		log.Printf("custodial sign: %v", err)
+		http.Error(w, "key unavailable", http.StatusServiceUnavailable)
+	case errors.Is(err, errAudit):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		log.Printf("custodial sign: %v", err)
+		http.Error(w, "signing error", http.StatusInternalServerError)
+	}
+}
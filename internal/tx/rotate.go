@@ -0,0 +1,331 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/audit"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/mempool"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/policy"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
+)
+
+// RotateRequest is sent twice, like ConsolidateRequest: first without a
+// signature to set up the successor and get the sweep to sign, then with the
+// preview's inputs, fee and timestamp plus the signature.
+type RotateRequest struct {
+	WalletID          string `json:"wallet_id"`
+	SuccessorWalletID string `json:"successor_wallet_id"` // optional; a new wallet is planned when empty
+	SuccessorKey      string `json:"successor_key"`       // from the preview, when it planned a new successor
+	Passphrase        string `json:"passphrase"`          // optional; protects a newly created successor
+	Confirm           bool   `json:"confirm"`             // retire a wallet the preview found nothing to sweep in
+
+	Inputs     []string `json:"inputs"`
+	Fee        int64    `json:"fee"`
+	Timestamp  string   `json:"timestamp"`
+	Nonce      string   `json:"nonce"`
+	SignatureR string   `json:"signature_r"`
+	SignatureS string   `json:"signature_s"`
+	Signature  string   `json:"signature"` // optional instead of r/s: hex of DER or 64-byte compact r||s
+}
+
+const rotateNote = "rotate"
+
+// maxSweepInputs caps the inputs of one sweep; rotate again to sweep the rest.
+const maxSweepInputs = 500
+
+// ✅ Replace a wallet: sweep all its UTXOs to a successor and retire it
+//
+// The preview changes nothing. The signed request (or, with nothing to sweep,
+// the confirmed one) creates a planned successor, records it, submits the
+// sweep and retires the wallet in one transaction.
+func RotateHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req RotateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WalletID == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := address.Normalize(&req.WalletID, &req.SuccessorWalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := wallet.EnsureWalletOwnedByUser(dbPool, req.WalletID, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	signed := req.SignatureR != "" || req.SignatureS != "" || req.Signature != ""
+	if !signed && !req.Confirm {
+		rot, err := wallet.PlanRotation(ctx, req.WalletID, userID, req.SuccessorWalletID, req.Passphrase)
+		if writeRotationError(w, req.WalletID, err) {
+			return
+		}
+		rotatePreview(w, req, rot)
+		return
+	}
+
+	if signed && (len(req.Inputs) == 0 || req.Fee <= 0 || req.Timestamp == "" || req.Nonce == "") {
+		http.Error(w, "missing or invalid fields", http.StatusBadRequest)
+		return
+	}
+
+	var senderPubHex, keyType string
+	var sum int64
+	var found int
+	if err := dbPool.QueryRow(ctx,
+		`SELECT w.public_key, w.key_type, COALESCE(SUM(u.amount),0), COUNT(u.utxo_id)
+         FROM wallets w
+         LEFT JOIN utxos u ON u.wallet_id = w.wallet_id AND u.spent=false AND u.utxo_id = ANY($2::uuid[])
+         WHERE w.wallet_id=$1
+         GROUP BY w.public_key, w.key_type`, req.WalletID, req.Inputs).
+		Scan(&senderPubHex, &keyType, &sum, &found); err != nil {
+		http.Error(w, "invalid wallet", http.StatusBadRequest)
+		return
+	}
+	if found != len(req.Inputs) {
+		http.Error(w, ErrInputsUnavailable.Error(), http.StatusConflict)
+		return
+	}
+	amount := sum - req.Fee
+	if signed && amount <= 0 {
+		http.Error(w, "fee exceeds inputs", http.StatusBadRequest)
+		return
+	}
+
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+
+	rot, err := wallet.CommitRotation(ctx, dbTx, req.WalletID, userID, req.SuccessorWalletID, req.SuccessorKey, req.Passphrase)
+	if writeRotationError(w, req.WalletID, err) {
+		return
+	}
+	successor := rot.SuccessorID
+	// The sweep stays with the owner; the successor takes over the limits.
+	if err := policy.Inherit(ctx, dbTx, req.WalletID, successor); err != nil {
+		log.Printf("rotate: inherit policy: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	var pending *Pending
+	if signed {
+		payload := CanonicalPayload(req.WalletID, successor, amount, req.Timestamp, rotateNote)
+		pubKey, err := crypto.ParsePublicKey(keyType, senderPubHex)
+		if err != nil {
+			http.Error(w, "invalid sender public key", http.StatusBadRequest)
+			return
+		}
+		sigR, sigS, err := pubKey.ParseSignature(req.Signature, req.SignatureR, req.SignatureS)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !pubKey.Verify([]byte(payload), sigR, sigS) {
+			http.Error(w, "invalid signature", http.StatusBadRequest)
+			return
+		}
+
+		pending, err = SubmitTx(ctx, dbTx, Transfer{
+			FromWalletID:    req.WalletID,
+			ToWalletID:      successor,
+			Amount:          amount,
+			Fee:             req.Fee,
+			Nonce:           req.Nonce,
+			Timestamp:       req.Timestamp,
+			Note:            rotateNote,
+			SenderPublicKey: senderPubHex,
+			SignatureR:      sigR,
+			SignatureS:      sigS,
+			Inputs:          req.Inputs,
+			PolicyExempt:    true,
+		})
+		if errors.Is(err, ErrInputsUnavailable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, ErrInsufficientFunds) || errors.Is(err, fee.ErrTooLow) || errors.Is(err, fee.ErrTooHigh) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("rotate: %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// Confirmed without a sweep: only a wallet with nothing to sweep retires this way
+		var unspent int
+		if err := dbTx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM utxos WHERE wallet_id=$1 AND spent=false`, req.WalletID).Scan(&unspent); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if unspent > 0 {
+			http.Error(w, "wallet still holds funds: sign the sweep from the preview", http.StatusConflict)
+			return
+		}
+	}
+
+	if err := wallet.Retire(ctx, dbTx, req.WalletID, successor); err != nil {
+		log.Printf("rotate: retire %s: %v", req.WalletID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	var resp *SendResponse
+	txID := ""
+	if pending != nil {
+		if resp, err = pending.Publish(ctx); err != nil {
+			// The wallet is retired; rotating it again sweeps what is left
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		txID = resp.TxID
+	}
+	recordRotation(r, userID, req.WalletID, successor, txID)
+
+	var remaining int
+	_ = dbPool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM utxos WHERE wallet_id=$1 AND spent=false`, req.WalletID).Scan(&remaining)
+
+	out := map[string]any{
+		"wallet_id":           req.WalletID,
+		"address":             address.For(req.WalletID),
+		"successor_wallet_id": successor,
+		"successor_address":   address.For(successor),
+		"successor_created":   rot.Created,
+		"retired":             true,
+		"remaining_utxos":     remaining,
+	}
+	if resp != nil {
+		out["sweep"] = resp
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// writeRotationError maps PlanRotation and CommitRotation failures to
+// responses; it reports whether err was written.
+func writeRotationError(w http.ResponseWriter, walletID string, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, wallet.ErrSuccessorMismatch), errors.Is(err, wallet.ErrStaleSuccessor):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, wallet.ErrInvalidSuccessor), errors.Is(err, wallet.ErrNoSuccessor),
+		errors.Is(err, envelope.ErrPassphrase), errors.Is(err, envelope.ErrNotEnvelope):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, envelope.ErrWrongPassphrase):
+		http.Error(w, "wrong passphrase", http.StatusUnauthorized)
+	default:
+		log.Printf("rotate %s: %v", walletID, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// rotatePreview shows the sweep to sign, or that there is none. It changes
+// nothing: a new successor is only planned, its sealed key returned as
+// successor_key for the signed or confirmed request.
+func rotatePreview(w http.ResponseWriter, req RotateRequest, rot *wallet.Rotation) {
+	ctx := context.Background()
+	rows, err := dbPool.Query(ctx,
+		`SELECT utxo_id::text, amount FROM utxos
+         WHERE wallet_id=$1 AND spent=false
+         ORDER BY created_at ASC LIMIT $2`, req.WalletID, maxSweepInputs)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	var inputs []string
+	var sum int64
+	for rows.Next() {
+		var id string
+		var amt int64
+		if err := rows.Scan(&id, &amt); err != nil {
+			rows.Close()
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		inputs = append(inputs, id)
+		sum += amt
+	}
+	rows.Close()
+
+	out := map[string]any{
+		"wallet_id":           req.WalletID,
+		"address":             address.For(req.WalletID),
+		"successor_wallet_id": rot.SuccessorID,
+		"successor_address":   address.For(rot.SuccessorID),
+		"successor_created":   false,
+		"successor_new":       rot.Created,
+		"retired":             false,
+	}
+	if rot.SuccessorKey != "" {
+		out["successor_key"] = rot.SuccessorKey
+	}
+
+	// Nothing to sweep: the wallet retires once confirmed
+	if len(inputs) == 0 {
+		out["confirm_required"] = true
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	feePolicy := fee.Current()
+	tier := "standard"
+	_ = dbPool.QueryRow(ctx, `SELECT tier FROM wallets WHERE wallet_id=$1`, req.WalletID).Scan(&tier)
+	txFee := feePolicy.Required(fee.Params{Size: mempool.EstimateSize(len(inputs), 1), Amount: sum, Tier: tier})
+	amount := sum - txFee
+	if amount <= 0 || feePolicy.IsDust(amount) {
+		http.Error(w, "balance does not cover the sweep fee", http.StatusBadRequest)
+		return
+	}
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+
+	out["inputs"] = inputs
+	out["input_total"] = sum
+	out["fee"] = txFee
+	out["amount"] = amount
+	out["timestamp"] = timestamp
+	out["note"] = rotateNote
+	out["payload"] = CanonicalPayload(req.WalletID, rot.SuccessorID, amount, timestamp, rotateNote)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func recordRotation(r *http.Request, userID, walletID, successor, txID string) {
+	if err := audit.Record(context.Background(), audit.Event{
+		Action: "wallet.rotate", Outcome: audit.Success, UserID: userID, WalletID: walletID,
+		RemoteIP: audit.RemoteIP(r),
+		Details:  map[string]any{"successor_wallet_id": successor, "sweep_tx_id": txID},
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
@@ -3,14 +3,20 @@ package tx
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/audit"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/invoice"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/policy"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
 )
 
@@ -19,35 +25,40 @@ var dbPool *pgxpool.Pool
 func Init(pool *pgxpool.Pool) { dbPool = pool }
 
 type SendRequest struct {
-	FromWalletID string `json:"from_wallet_id"`
-	ToWalletID   string `json:"to_wallet_id"`
-	Amount       int64  `json:"amount"`      // smallest units
-	Fee          int64  `json:"fee"`         // optional (can be calculated server-side); if 0, server calculates
-	Nonce        string `json:"nonce"`       // client-provided idempotency key
-	Timestamp    string `json:"timestamp"`   // RFC3339 string (included in signed payload)
-	Note         string `json:"note"`        // optional note (included in signed payload)
-	SignatureR   string `json:"signature_r"` // hex (ECDSA r)
-	SignatureS   string `json:"signature_s"` // hex (ECDSA s)
+	FromWalletID  string   `json:"from_wallet_id"` // wallet ID or address; optional, the user's default wallet when empty
+	ToWalletID    string   `json:"to_wallet_id"`   // wallet ID or address
+	ToContact     string   `json:"to_contact"`     // optional instead of to_wallet_id; the payload is signed with the contact's wallet ID
+	Amount        int64    `json:"amount"`         // smallest units
+	Fee           int64    `json:"fee"`            // optional; if 0, the fee policy's required fee is used
+	Nonce         string   `json:"nonce"`          // client-provided idempotency key
+	Timestamp     string   `json:"timestamp"`      // RFC3339 string (included in signed payload)
+	Note          string   `json:"note"`           // optional note (included in signed payload)
+	SignatureR    string   `json:"signature_r"`    // 64 hex chars (ECDSA r, or the first half of an Ed25519 signature)
+	SignatureS    string   `json:"signature_s"`    // 64 hex chars (ECDSA s, low-S, or the second half)
+	Signature     string   `json:"signature"`      // optional instead of r/s: hex of 64-byte compact r||s, or DER for ECDSA
+	InvoiceID     string   `json:"invoice_id"`     // optional; otherwise taken from a note of the form "invoice:<id>"
+	AllowRetired  bool     `json:"allow_retired"`
+	ConfirmedOnly bool     `json:"confirmed_only"` // spend only outputs of confirmed transactions
+	OverrideOTP   string   `json:"override_otp"`   // policy_override OTP from /auth/reauth; lets the owner send past the wallet's spending policy
+	Inputs        []string `json:"inputs"`         // optional UTXOs to spend; those of a pending send from this wallet replace it for a higher fee
+}
+
+type Output struct {
+	WalletID string `json:"wallet_id"`
+	Address  string `json:"address"`
+	Amount   int64  `json:"amount"`
+	Index    int    `json:"index"`
 }
 
 type SendResponse struct {
 	TxID    string   `json:"tx_id"`
 	Status  string   `json:"status"`
 	Inputs  []string `json:"inputs"`
-	Outputs []struct {
-		WalletID string `json:"wallet_id"`
-		Amount   int64  `json:"amount"`
-		Index    int    `json:"index"`
-	} `json:"outputs"`
-}
+	Outputs []Output `json:"outputs"`
 
-// Deterministic fee policy: 1% capped at 1000 units (adjust as needed)
-func calcFee(amount int64) int64 {
-	fee := amount / 100
-	if fee > 1000 {
-		fee = 1000
-	}
-	return fee
+	InvoiceID     string `json:"invoice_id,omitempty"`
+	InvoiceStatus string `json:"invoice_status,omitempty"`
+	Warning       string `json:"warning,omitempty"`
 }
 
 func SendHandler(w http.ResponseWriter, r *http.Request) {
@@ -63,6 +74,56 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	send(w, r, userID, req, nil)
+}
+
+// signFunc signs a canonical payload on the server for the sender's wallet.
+type signFunc func(ctx context.Context, req SendRequest, pub crypto.PublicKey, payload string) (string, string, error)
+
+// send is the path shared by every transfer endpoint: recipient resolution,
+// ownership, retired-recipient and spending-policy checks, signature, invoice
+// matching and Submit. With a nil sign the client's signature in req is
+// verified; otherwise sign produces it.
+func send(w http.ResponseWriter, r *http.Request, userID string, req SendRequest, sign signFunc) {
+	ctx := context.Background()
+
+	// Addresses are checked strictly: a typo fails its checksum here instead
+	// of reaching a wallet lookup. Signed payloads always use the wallet ID.
+	if err := address.Normalize(&req.FromWalletID, &req.ToWalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Resolve the default sender wallet and address book recipients
+	if req.FromWalletID == "" {
+		id, err := wallet.DefaultWallet(ctx, userID)
+		if errors.Is(err, wallet.ErrNoDefaultWallet) {
+			http.Error(w, "from_wallet_id required: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		req.FromWalletID = id
+	}
+	if req.ToContact != "" {
+		id, err := wallet.ResolveContact(ctx, userID, req.ToContact)
+		if errors.Is(err, wallet.ErrContactNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if req.ToWalletID != "" && req.ToWalletID != id {
+			http.Error(w, "to_wallet_id does not match to_contact", http.StatusBadRequest)
+			return
+		}
+		req.ToWalletID = id
+	}
+
 	// Required fields
 	if req.FromWalletID == "" || req.ToWalletID == "" || req.Amount <= 0 || req.Nonce == "" || req.Timestamp == "" {
 		http.Error(w, "missing or invalid fields", http.StatusBadRequest)
@@ -79,13 +140,11 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-
 	// Fetch sender public key and verify receiver exists
-	var senderPubHex string
+	var senderPubHex, keyType string
 	if err := dbPool.QueryRow(ctx,
-		`SELECT public_key FROM wallets WHERE wallet_id=$1`, req.FromWalletID).
-		Scan(&senderPubHex); err != nil {
+		`SELECT public_key, key_type FROM wallets WHERE wallet_id=$1`, req.FromWalletID).
+		Scan(&senderPubHex, &keyType); err != nil {
 		http.Error(w, "invalid sender wallet", http.StatusBadRequest)
 		return
 	}
@@ -98,184 +157,143 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Canonical payload for signature verification (must match client signing exactly)
-	payload := fmt.Sprintf("sender=%s|receiver=%s|amount=%d|timestamp=%s|note=%s",
-		req.FromWalletID, req.ToWalletID, req.Amount, req.Timestamp, req.Note)
-
-	// Verify ECDSA signature
-	pubKey, err := crypto.DeserializePublicKey(senderPubHex)
-	if err != nil {
-		http.Error(w, "invalid sender public key", http.StatusBadRequest)
-		return
-	}
-	if !crypto.VerifySignature(pubKey, []byte(payload), req.SignatureR, req.SignatureS) {
-		http.Error(w, "invalid signature", http.StatusBadRequest)
+	// A retired recipient has rotated its key; funds belong at its successor.
+	// The signature covers the recipient, so the client must re-sign to redirect.
+	var warning string
+	if retired, successor, err := wallet.Successor(ctx, req.ToWalletID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
 		return
+	} else if retired {
+		warning = "recipient wallet is retired; its successor is " + successor
+		if !req.AllowRetired {
+			http.Error(w, warning, http.StatusConflict)
+			return
+		}
 	}
 
-	// Fee (allow client to pass or compute server-side)
-	fee := req.Fee
-	if fee <= 0 {
-		fee = calcFee(req.Amount)
-	}
-	total := req.Amount + fee
-
-	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		http.Error(w, "db begin error", http.StatusInternalServerError)
-		return
+	// Spending policy is enforced before the signature is even looked at;
+	// Submit checks it again with the wallet locked, unless overridden below.
+	var violation *policy.Violation
+	if err := policy.Check(ctx, dbPool, req.FromWalletID, req.ToWalletID, req.Amount, time.Now()); err != nil {
+		if !errors.As(err, &violation) {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if req.OverrideOTP == "" {
+			http.Error(w, violation.Error(), http.StatusForbidden)
+			return
+		}
 	}
-	defer func() {
-		if tx != nil {
-			_ = tx.Rollback(ctx)
+	recordOverride := func(outcome, reason string) {
+		if err := audit.Record(ctx, audit.Event{
+			Action: "wallet.policy_override", Outcome: outcome, UserID: userID, WalletID: req.FromWalletID,
+			Reason: reason, RemoteIP: audit.RemoteIP(r),
+			Details: map[string]any{"to_wallet_id": req.ToWalletID, "amount": req.Amount, "rule": violation.Rule},
+		}); err != nil {
+			log.Printf("audit: %v", err)
 		}
-	}()
-
-	// Idempotency: nonce unique per from_wallet_id
-	var existingTxID string
-	err = tx.QueryRow(ctx,
-		`SELECT tx_id::text FROM transactions WHERE from_wallet_id=$1 AND nonce=$2`,
-		req.FromWalletID, req.Nonce).Scan(&existingTxID)
-	if err == nil && existingTxID != "" {
-		// Return existing response for idempotent requests
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{
-			"tx_id":  existingTxID,
-			"status": "pending",
-		})
-		_ = tx.Rollback(ctx)
-		return
 	}
 
-	// Gather unspent UTXOs
-	rows, err := tx.Query(ctx,
-		`SELECT utxo_id::text, amount
-         FROM utxos
-         WHERE wallet_id=$1 AND spent=false
-         ORDER BY created_at ASC`, req.FromWalletID)
+	// Canonical payload for signature verification (must match client signing exactly)
+	payload := CanonicalPayload(req.FromWalletID, req.ToWalletID, req.Amount, req.Timestamp, req.Note)
+
+	// Verify the signature under the wallet's key type
+	pubKey, err := crypto.ParsePublicKey(keyType, senderPubHex)
 	if err != nil {
-		http.Error(w, "db utxo query error", http.StatusInternalServerError)
+		http.Error(w, "invalid sender public key", http.StatusBadRequest)
 		return
 	}
-
-	var selected []struct {
-		UTXOID string
-		Amount int64
-	}
-	var sum int64
-	for rows.Next() {
-		var id string
-		var amt int64
-		if err := rows.Scan(&id, &amt); err != nil {
-			http.Error(w, "db scan error", http.StatusInternalServerError)
+	var sigR, sigS string
+	if sign != nil {
+		if sigR, sigS, err = sign(ctx, req, pubKey, payload); err != nil {
+			writeSignError(w, err)
 			return
 		}
-		selected = append(selected, struct {
-			UTXOID string
-			Amount int64
-		}{UTXOID: id, Amount: amt})
-		sum += amt
-		if sum >= total {
-			break
-		}
-	}
-	rows.Close()
-
-	if sum < total {
-		http.Error(w, "insufficient funds", http.StatusBadRequest)
+	} else if sigR, sigS, err = pubKey.ParseSignature(req.Signature, req.SignatureR, req.SignatureS); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Create transaction row (pending) with signature/public key stored
-	var newTxID string
-	err = tx.QueryRow(ctx,
-		`INSERT INTO transactions (
-            from_wallet_id, to_wallet_id, amount, fee, nonce,
-            sender_public_key, signature_r, signature_s, note, timestamp, status
-         )
-         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,'pending')
-         RETURNING tx_id::text`,
-		req.FromWalletID, req.ToWalletID, req.Amount, fee, req.Nonce,
-		senderPubHex, req.SignatureR, req.SignatureS, req.Note, req.Timestamp).
-		Scan(&newTxID)
-	if err != nil {
-		http.Error(w, "db insert transaction error", http.StatusInternalServerError)
+	if !pubKey.Verify([]byte(payload), sigR, sigS) {
+		http.Error(w, "invalid signature", http.StatusBadRequest)
 		return
 	}
 
-	// Mark selected UTXOs spent, create transaction inputs
-	for _, s := range selected {
-		if _, err = tx.Exec(ctx, `UPDATE utxos SET spent=true WHERE utxo_id=$1`, s.UTXOID); err != nil {
-			http.Error(w, "db update utxo error", http.StatusInternalServerError)
+	// The override code is only spent on a correctly signed transfer
+	if violation != nil {
+		err := auth.ConsumeOTP(ctx, userID, auth.PurposePolicyOverride, req.OverrideOTP)
+		if errors.Is(err, auth.ErrOTPLocked) || errors.Is(err, auth.ErrInvalidOTP) {
+			recordOverride(audit.Denied, violation.Error()+": "+err.Error())
+			status := http.StatusForbidden
+			if errors.Is(err, auth.ErrOTPLocked) {
+				status = http.StatusTooManyRequests
+			}
+			http.Error(w, violation.Error()+"; override rejected: "+err.Error(), status)
 			return
 		}
-		if _, err = tx.Exec(ctx,
-			`INSERT INTO transaction_inputs (tx_id, utxo_id) VALUES ($1,$2)`,
-			newTxID, s.UTXOID); err != nil {
-			http.Error(w, "db insert input error", http.StatusInternalServerError)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
 			return
 		}
 	}
 
-	// Create outputs: recipient and change (if any)
-	change := sum - total
-	// output_index 0 → recipient
-	if _, err = tx.Exec(ctx,
-		`INSERT INTO transaction_outputs (tx_id, wallet_id, amount, output_index)
-         VALUES ($1,$2,$3,0)`,
-		newTxID, req.ToWalletID, req.Amount); err != nil {
-		http.Error(w, "db insert output error", http.StatusInternalServerError)
-		return
+	// Invoice matching: refuse to pay a closed invoice or the wrong merchant
+	// wallet. Submit checks again with the invoice locked as it records the payment.
+	invoiceID := req.InvoiceID
+	if invoiceID == "" {
+		invoiceID = invoice.FromNote(req.Note)
 	}
-	// output_index 1 → change (optional)
-	if change > 0 {
-		if _, err = tx.Exec(ctx,
-			`INSERT INTO transaction_outputs (tx_id, wallet_id, amount, output_index)
-             VALUES ($1,$2,$3,1)`,
-			newTxID, req.FromWalletID, change); err != nil {
-			http.Error(w, "db insert change output error", http.StatusInternalServerError)
+	if invoiceID != "" {
+		if err := invoice.Payable(ctx, invoiceID, req.ToWalletID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
 
-	// Materialize outputs into UTXOs
-	if _, err = tx.Exec(ctx,
-		`INSERT INTO utxos (wallet_id, tx_id, output_index, amount, spent)
-         SELECT wallet_id, tx_id, output_index, amount, false
-         FROM transaction_outputs
-         WHERE tx_id=$1`,
-		newTxID); err != nil {
-		http.Error(w, "db insert utxos error", http.StatusInternalServerError)
-		return
+	resp, err := Submit(ctx, Transfer{
+		FromWalletID:    req.FromWalletID,
+		ToWalletID:      req.ToWalletID,
+		Amount:          req.Amount,
+		Fee:             req.Fee,
+		Nonce:           req.Nonce,
+		Timestamp:       req.Timestamp,
+		Note:            req.Note,
+		SenderPublicKey: senderPubHex,
+		SignatureR:      sigR,
+		SignatureS:      sigS,
+		ConfirmedOnly:   req.ConfirmedOnly,
+		PolicyExempt:    violation != nil,
+		InvoiceID:       invoiceID,
+		Inputs:          req.Inputs,
+	})
+	if violation != nil {
+		if err != nil {
+			recordOverride(audit.Failed, violation.Error()+": "+err.Error())
+		} else {
+			recordOverride(audit.Success, violation.Error())
+		}
 	}
-
-	if err := tx.Commit(ctx); err != nil {
-		http.Error(w, "db commit error", http.StatusInternalServerError)
+	var v *policy.Violation
+	if errors.As(err, &v) {
+		http.Error(w, v.Error(), http.StatusForbidden)
 		return
 	}
-	tx = nil
-
-	// Build response
-	resp := SendResponse{
-		TxID:   newTxID,
-		Status: "pending",
+	if errors.Is(err, ErrInsufficientFunds) || errors.Is(err, fee.ErrTooLow) || errors.Is(err, fee.ErrTooHigh) ||
+		errors.Is(err, invoice.ErrNotFound) || errors.Is(err, invoice.ErrNotPayable) || errors.Is(err, invoice.ErrWrongWallet) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	for _, s := range selected {
-		resp.Inputs = append(resp.Inputs, s.UTXOID)
+	if errors.Is(err, ErrInputsUnavailable) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
 	}
-	resp.Outputs = append(resp.Outputs, struct {
-		WalletID string "json:\"wallet_id\""
-		Amount   int64  "json:\"amount\""
-		Index    int    "json:\"index\""
-	}{WalletID: req.ToWalletID, Amount: req.Amount, Index: 0})
-	if change > 0 {
-		resp.Outputs = append(resp.Outputs, struct {
-			WalletID string "json:\"wallet_id\""
-			Amount   int64  "json:\"amount\""
-			Index    int    "json:\"index\""
-		}{WalletID: req.FromWalletID, Amount: change, Index: 1})
+	if err != nil {
+		log.Printf("send: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
 	}
 
+	resp.Warning = warning
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,184 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Transaction lifecycle states.
+const (
+	StatusPending   = "pending"
+	StatusCommitted = "committed" // included in a block
+	StatusConfirmed = "confirmed" // block is at least ConfirmationDepth deep
+	StatusRejected  = "rejected"  // failed re-validation at commit
+	StatusExpired   = "expired"   // stayed pending longer than PENDING_TTL
+	StatusReplaced  = "replaced"  // superseded by a conflicting transaction
+)
+
+// transitions lists the statuses reachable from each status. Terminal states
+// have no entry.
+var transitions = map[string][]string{
+	StatusPending:   {StatusCommitted, StatusRejected, StatusExpired, StatusReplaced},
+	StatusCommitted: {StatusConfirmed},
+}
+
+// CanTransition reports whether the lifecycle allows moving from one status to another.
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Querier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// ConfirmationDepth is the number of blocks (including its own) after which a
+// committed transaction counts as confirmed. Set with CONFIRMATION_DEPTH.
+func ConfirmationDepth() int {
+	if n, err := strconv.Atoi(os.Getenv("CONFIRMATION_DEPTH")); err == nil && n > 0 {
+		return n
+	}
+	return 6
+}
+
+// PendingTTL is how long a transaction may stay pending before it expires.
+// Set with PENDING_TTL as a Go duration, e.g. "72h".
+func PendingTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PENDING_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 72 * time.Hour
+}
+
+// Confirmations is the depth of a block at height in a chain whose tip is at
+// tip; 0 for transactions not in a block.
+func Confirmations(tip int, height *int) int {
+	if height == nil || *height > tip {
+		return 0
+	}
+	return tip - *height + 1
+}
+
+// SetStatus moves a transaction along its lifecycle and records the change
+// in transaction_status_history. blockID may be empty.
+func SetStatus(ctx context.Context, q Querier, txID, to, reason, blockID string) error {
+	var from string
+	if err := q.QueryRow(ctx,
+		`SELECT status FROM transactions WHERE tx_id=$1::uuid FOR UPDATE`, txID).Scan(&from); err != nil {
+		return fmt.Errorf("status of %s: %w", txID, err)
+	}
+	if !CanTransition(from, to) {
+		return fmt.Errorf("transaction %s: cannot move from %s to %s", txID, from, to)
+	}
+
+	var block any
+	if blockID != "" {
+		block = blockID
+	}
+	var rejectReason any
+	if to == StatusRejected || to == StatusExpired || to == StatusReplaced {
+		rejectReason = reason
+	}
+	if _, err := q.Exec(ctx,
+		`UPDATE transactions
+         SET status=$2, block_id=COALESCE($3::uuid, block_id), reject_reason=COALESCE($4, reject_reason)
+         WHERE tx_id=$1::uuid`,
+		txID, to, block, rejectReason); err != nil {
+		return fmt.Errorf("update status of %s: %w", txID, err)
+	}
+	return recordStatus(ctx, q, txID, from, to, reason, blockID)
+}
+
+func recordStatus(ctx context.Context, q Querier, txID, from, to, reason, blockID string) error {
+	var fromStatus, block, why any
+	if from != "" {
+		fromStatus = from
+	}
+	if blockID != "" {
+		block = blockID
+	}
+	if reason != "" {
+		why = reason
+	}
+	if _, err := q.Exec(ctx,
+		`INSERT INTO transaction_status_history (tx_id, from_status, to_status, reason, block_id)
+         VALUES ($1::uuid,$2,$3,$4,$5::uuid)`,
+		txID, fromStatus, to, why, block); err != nil {
+		return fmt.Errorf("record status of %s: %w", txID, err)
+	}
+	return nil
+}
+
+// PromoteConfirmed marks committed transactions confirmed once their block is
+// ConfirmationDepth deep below tip. It returns the promoted transaction IDs.
+func PromoteConfirmed(ctx context.Context, q Querier, tip int) ([]string, error) {
+	rows, err := q.Query(ctx,
+		`SELECT t.tx_id::text FROM transactions t
+         JOIN blocks b ON b.block_id = t.block_id
+         WHERE t.status=$1 AND $2 - b.height + 1 >= $3`,
+		StatusCommitted, tip, ConfirmationDepth())
+	if err != nil {
+		return nil, fmt.Errorf("query committed: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan committed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := SetStatus(ctx, q, id, StatusConfirmed, fmt.Sprintf("%d confirmations", ConfirmationDepth()), ""); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// ExpireStale expires transactions pending for longer than PendingTTL and
+// unwinds them like a rejection. It returns the expired transaction IDs.
+func ExpireStale(ctx context.Context, q pgx.Tx) ([]string, error) {
+	rows, err := q.Query(ctx,
+		`SELECT tx_id::text FROM transactions
+         WHERE status=$1 AND created_at < $2
+         ORDER BY created_at DESC`,
+		StatusPending, time.Now().Add(-PendingTTL()))
+	if err != nil {
+		return nil, fmt.Errorf("query stale: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan stale: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	// Newest first, so children release their inputs before their parents do.
+	for _, id := range ids {
+		if err := drop(ctx, q, id, StatusExpired, "pending longer than "+PendingTTL().String()); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
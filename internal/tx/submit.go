@@ -0,0 +1,443 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/invoice"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/mempool"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/policy"
+)
+
+// ErrInsufficientFunds is returned by Submit when the sender's unspent
+// outputs cannot cover amount plus fee.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// ErrInputsUnavailable is returned when explicitly chosen inputs are missing,
+// already spent or not owned by the sender.
+var ErrInputsUnavailable = errors.New("inputs unavailable")
+
+// Transaction kinds. System transactions are created by the server (zakat),
+// carry no signature and pay no fee.
+const (
+	KindTransfer = "transfer"
+	KindSystem   = "system"
+)
+
+// Transfer is a signed value transfer ready to be recorded as a pending transaction.
+type Transfer struct {
+	FromWalletID    string
+	ToWalletID      string
+	Amount          int64
+	Fee             int64 // if 0, the fee policy's required fee is applied
+	Nonce           string
+	Timestamp       string
+	Note            string
+	SenderPublicKey string
+	SignatureR      string
+	SignatureS      string
+	MandateID       string   // set when the signature authorizes a payment mandate rather than this transfer
+	Kind            string   // KindTransfer when empty
+	Inputs          []string // explicit UTXOs to spend; chosen oldest-first when empty. Inputs held by the sender's own pending transactions replace them, see replaceByFee
+	ConfirmedOnly   bool     // spend only outputs of confirmed transactions
+	PolicyExempt    bool     // skip the spending policy: an owner-approved override or a rotation sweep
+	InvoiceID       string   // invoice this transfer pays; recorded with it or not at all
+}
+
+// confirmedFilter restricts a utxos query to confirmed outputs when the
+// boolean parameter param is true. Outputs without a creating transaction
+// count as confirmed.
+func confirmedFilter(param string) string {
+	return `
+               AND (NOT ` + param + `::boolean OR tx_id IS NULL OR EXISTS (
+                   SELECT 1 FROM transactions ct WHERE ct.tx_id = utxos.tx_id AND ct.status = 'confirmed'))`
+}
+
+// CanonicalPayload builds the exact string a sender signs for a transfer.
+func CanonicalPayload(from, to string, amount int64, timestamp, note string) string {
+	return fmt.Sprintf("sender=%s|receiver=%s|amount=%d|timestamp=%s|note=%s",
+		from, to, amount, timestamp, note)
+}
+
+// MandatePayload is the string a payer signs to authorize a recurring payment.
+// Transactions executed from the mandate carry that signature.
+func MandatePayload(from, to string, amount int64, interval, startAt, timestamp, note string) string {
+	return fmt.Sprintf("mandate|sender=%s|receiver=%s|amount=%d|interval=%s|start=%s|timestamp=%s|note=%s",
+		from, to, amount, interval, startAt, timestamp, note)
+}
+
+// Submit selects unspent outputs of the sender, records the transaction as
+// pending and materializes its outputs. Transfers are held to the sender's
+// spending policy; signature checks are the caller's job.
+// A repeated nonce returns the existing transaction instead of creating a new one.
+func Submit(ctx context.Context, t Transfer) (*SendResponse, error) {
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("db begin error: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	p, err := SubmitTx(ctx, tx, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("db commit error: %w", err)
+	}
+	return p.Publish(ctx)
+}
+
+// Pending is a transaction recorded by SubmitTx that is not in the mempool yet.
+type Pending struct {
+	resp     *SendResponse
+	entry    *mempool.Entry // nil for a repeated nonce
+	replaced []string       // transactions it replaced, to evict from the mempool
+}
+
+// SubmitTx is Submit inside the caller's database transaction, for callers
+// that record their own state together with the transfer. Once tx is
+// committed the caller must Publish the result.
+func SubmitTx(ctx context.Context, tx pgx.Tx, t Transfer) (*Pending, error) {
+	if t.Kind == "" {
+		t.Kind = KindTransfer
+	}
+	feePolicy := fee.Current()
+	if t.Kind != KindSystem && feePolicy.MaxFee > 0 && t.Fee > feePolicy.MaxFee {
+		return nil, fmt.Errorf("%w: %d > %d", fee.ErrTooHigh, t.Fee, feePolicy.MaxFee)
+	}
+
+	// Idempotency: nonce unique per from_wallet_id
+	var existingTxID string
+	err := tx.QueryRow(ctx,
+		`SELECT tx_id::text FROM transactions WHERE from_wallet_id=$1 AND nonce=$2`,
+		t.FromWalletID, t.Nonce).Scan(&existingTxID)
+	if err == nil && existingTxID != "" {
+		return &Pending{resp: &SendResponse{TxID: existingTxID, Status: StatusPending}}, nil
+	}
+
+	// Spending policy, checked with the sender's wallet row locked so that
+	// concurrent transfers are counted against its caps one after another.
+	if t.Kind == KindTransfer && !t.PolicyExempt {
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM wallets WHERE wallet_id=$1 FOR UPDATE`, t.FromWalletID); err != nil {
+			return nil, fmt.Errorf("db lock wallet error: %w", err)
+		}
+		if err := policy.Check(ctx, tx, t.FromWalletID, t.ToWalletID, t.Amount, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	tier := "standard"
+	_ = tx.QueryRow(ctx, `SELECT tier FROM wallets WHERE wallet_id=$1`, t.FromWalletID).Scan(&tier)
+
+	// The required fee grows with the number of inputs, so it is recomputed as
+	// inputs are added. A client-supplied fee is used as-is and checked below.
+	feeParams := func(inputs int) fee.Params {
+		return fee.Params{
+			Size:   mempool.EstimateSize(inputs, 2),
+			Amount: t.Amount,
+			Tier:   tier,
+			System: t.Kind == KindSystem,
+		}
+	}
+	feeFor := func(inputs int) int64 {
+		if t.Fee > 0 && t.Kind != KindSystem {
+			return t.Fee
+		}
+		return feePolicy.Required(feeParams(inputs))
+	}
+	txFee := feeFor(1)
+
+	var selected []struct {
+		UTXOID string
+		Amount int64
+	}
+	var sum int64
+	var replaced []string
+	var replacedFee int64
+	if len(t.Inputs) > 0 && t.Kind == KindTransfer {
+		if replaced, replacedFee, err = replaceByFee(ctx, tx, t.FromWalletID, t.Inputs); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.Inputs) > 0 {
+		// Spend exactly the inputs the sender chose (consolidation, partially signed transactions)
+		rows, err := tx.Query(ctx,
+			`SELECT utxo_id::text, amount
+             FROM utxos
+             WHERE utxo_id = ANY($1::uuid[]) AND wallet_id=$2 AND spent=false`+confirmedFilter("$3")+`
+             FOR UPDATE`, t.Inputs, t.FromWalletID, t.ConfirmedOnly)
+		if err != nil {
+			return nil, fmt.Errorf("db utxo query error: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			var amt int64
+			if err := rows.Scan(&id, &amt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("db scan error: %w", err)
+			}
+			selected = append(selected, struct {
+				UTXOID string
+				Amount int64
+			}{UTXOID: id, Amount: amt})
+			sum += amt
+		}
+		rows.Close()
+		if len(selected) != len(t.Inputs) {
+			return nil, ErrInputsUnavailable
+		}
+		txFee = feeFor(len(selected))
+	} else {
+		// Gather unspent UTXOs
+		rows, err := tx.Query(ctx,
+			`SELECT utxo_id::text, amount
+             FROM utxos
+             WHERE wallet_id=$1 AND spent=false`+confirmedFilter("$2")+`
+             ORDER BY created_at ASC
+             FOR UPDATE`, t.FromWalletID, t.ConfirmedOnly)
+		if err != nil {
+			return nil, fmt.Errorf("db utxo query error: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			var amt int64
+			if err := rows.Scan(&id, &amt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("db scan error: %w", err)
+			}
+			selected = append(selected, struct {
+				UTXOID string
+				Amount int64
+			}{UTXOID: id, Amount: amt})
+			sum += amt
+			txFee = feeFor(len(selected))
+			if sum >= t.Amount+txFee {
+				break
+			}
+		}
+		rows.Close()
+	}
+
+	if sum < t.Amount+txFee {
+		if t.ConfirmedOnly {
+			return nil, fmt.Errorf("%w: not enough confirmed funds", ErrInsufficientFunds)
+		}
+		return nil, ErrInsufficientFunds
+	}
+	if err := feePolicy.Check(txFee, feeParams(len(selected))); err != nil {
+		return nil, err
+	}
+	if len(replaced) > 0 && txFee <= replacedFee {
+		return nil, fmt.Errorf("%w: a replacement must pay more than the %d it replaces", fee.ErrTooLow, replacedFee)
+	}
+	inputs := make([]string, len(selected))
+	for i, s := range selected {
+		inputs[i] = s.UTXOID
+	}
+	// Blocks are built from the mempool, so a transaction it would refuse
+	// must not be recorded either.
+	for _, c := range mempool.Default.Conflicts(inputs) {
+		if !slices.Contains(replaced, c) {
+			return nil, fmt.Errorf("%w: spent by pending transaction %s", ErrInputsUnavailable, c)
+		}
+	}
+	change := sum - t.Amount - txFee
+	// Dust change costs more to spend later than it is worth; give it to the fee
+	// unless that would push the fee over the policy maximum.
+	if feePolicy.IsDust(change) && t.Kind != KindSystem && (feePolicy.MaxFee == 0 || txFee+change <= feePolicy.MaxFee) {
+		txFee += change
+		change = 0
+	}
+
+	// Create transaction row (pending) with signature/public key stored
+	var mandateID any
+	if t.MandateID != "" {
+		mandateID = t.MandateID
+	}
+	var newTxID string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO transactions (
+            from_wallet_id, to_wallet_id, amount, fee, nonce,
+            sender_public_key, signature_r, signature_s, note, timestamp, mandate_id, kind, status
+         )
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11::uuid,$12,'pending')
+         RETURNING tx_id::text`,
+		t.FromWalletID, t.ToWalletID, t.Amount, txFee, t.Nonce,
+		t.SenderPublicKey, t.SignatureR, t.SignatureS, t.Note, t.Timestamp, mandateID, t.Kind).
+		Scan(&newTxID)
+	if err != nil {
+		return nil, fmt.Errorf("db insert transaction error: %w", err)
+	}
+	if err := recordStatus(ctx, tx, newTxID, "", StatusPending, "submitted", ""); err != nil {
+		return nil, err
+	}
+
+	// Mark selected UTXOs spent, create transaction inputs
+	for _, s := range selected {
+		if _, err = tx.Exec(ctx, `UPDATE utxos SET spent=true WHERE utxo_id=$1`, s.UTXOID); err != nil {
+			return nil, fmt.Errorf("db update utxo error: %w", err)
+		}
+		if _, err = tx.Exec(ctx,
+			`INSERT INTO transaction_inputs (tx_id, utxo_id) VALUES ($1,$2)`,
+			newTxID, s.UTXOID); err != nil {
+			return nil, fmt.Errorf("db insert input error: %w", err)
+		}
+	}
+
+	// Create outputs: recipient and change (if any)
+	// output_index 0 → recipient
+	if _, err = tx.Exec(ctx,
+		`INSERT INTO transaction_outputs (tx_id, wallet_id, amount, output_index)
+         VALUES ($1,$2,$3,0)`,
+		newTxID, t.ToWalletID, t.Amount); err != nil {
+		return nil, fmt.Errorf("db insert output error: %w", err)
+	}
+	// output_index 1 → change (optional)
+	if change > 0 {
+		if _, err = tx.Exec(ctx,
+			`INSERT INTO transaction_outputs (tx_id, wallet_id, amount, output_index)
+             VALUES ($1,$2,$3,1)`,
+			newTxID, t.FromWalletID, change); err != nil {
+			return nil, fmt.Errorf("db insert change output error: %w", err)
+		}
+	}
+
+	// Materialize outputs into UTXOs
+	if _, err = tx.Exec(ctx,
+		`INSERT INTO utxos (wallet_id, tx_id, output_index, amount, spent)
+         SELECT wallet_id, tx_id, output_index, amount, false
+         FROM transaction_outputs
+         WHERE tx_id=$1`,
+		newTxID); err != nil {
+		return nil, fmt.Errorf("db insert utxos error: %w", err)
+	}
+
+	var invoiceStatus string
+	if t.InvoiceID != "" {
+		if invoiceStatus, err = invoice.RecordPayment(ctx, tx, t.InvoiceID, t.ToWalletID, newTxID, t.Amount); err != nil {
+			return nil, fmt.Errorf("invoice %s: %w", t.InvoiceID, err)
+		}
+	}
+
+	entry := &mempool.Entry{
+		TxID:   newTxID,
+		From:   t.FromWalletID,
+		To:     t.ToWalletID,
+		Amount: t.Amount,
+		Fee:    txFee,
+		Inputs: inputs,
+	}
+	outputs := 1
+	if change > 0 {
+		outputs = 2
+	}
+	entry.Size = mempool.EstimateSize(len(entry.Inputs), outputs)
+
+	// Build response
+	resp := &SendResponse{
+		TxID:          newTxID,
+		Status:        StatusPending,
+		Inputs:        inputs,
+		InvoiceID:     t.InvoiceID,
+		InvoiceStatus: invoiceStatus,
+	}
+	resp.Outputs = append(resp.Outputs, Output{WalletID: t.ToWalletID, Address: address.For(t.ToWalletID), Amount: t.Amount, Index: 0})
+	if change > 0 {
+		resp.Outputs = append(resp.Outputs, Output{WalletID: t.FromWalletID, Address: address.For(t.FromWalletID), Amount: change, Index: 1})
+	}
+	return &Pending{resp: resp, entry: entry, replaced: replaced}, nil
+}
+
+// replaceByFee drops the sender's pending transactions that hold any of
+// inputs as replaced, releasing their inputs for the new transaction. The
+// caller must make the replacement pay more than the returned total fee, or
+// roll back. Transactions whose outputs are already spent again are not
+// replaced.
+func replaceByFee(ctx context.Context, tx pgx.Tx, fromWalletID string, inputs []string) ([]string, int64, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT tx_id::text, fee FROM transactions
+         WHERE status=$3 AND from_wallet_id=$2
+           AND tx_id IN (SELECT tx_id FROM transaction_inputs WHERE utxo_id = ANY($1::uuid[]))
+         FOR UPDATE`, inputs, fromWalletID, StatusPending)
+	if err != nil {
+		return nil, 0, fmt.Errorf("db replaceable query error: %w", err)
+	}
+	var ids []string
+	var total int64
+	for rows.Next() {
+		var id string
+		var f int64
+		if err := rows.Scan(&id, &f); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("db scan error: %w", err)
+		}
+		ids = append(ids, id)
+		total += f
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return nil, 0, nil
+	}
+
+	var spent bool
+	if err := tx.QueryRow(ctx,
+		`SELECT EXISTS (
+             SELECT 1 FROM utxos u
+             JOIN transaction_inputs ti ON ti.utxo_id = u.utxo_id
+             JOIN transactions c ON c.tx_id = ti.tx_id
+             WHERE u.tx_id = ANY($1::uuid[]) AND c.status NOT IN `+dropped+`)`, ids).Scan(&spent); err != nil {
+		return nil, 0, fmt.Errorf("db replaceable spenders error: %w", err)
+	}
+	if spent {
+		return nil, 0, fmt.Errorf("%w: outputs of a transaction to replace are already spent", ErrInputsUnavailable)
+	}
+	for _, id := range ids {
+		if err := drop(ctx, tx, id, StatusReplaced, "replaced by a higher-fee transaction"); err != nil {
+			return nil, 0, err
+		}
+	}
+	return ids, total, nil
+}
+
+// TxID is the ID of the recorded transaction.
+func (p *Pending) TxID() string { return p.resp.TxID }
+
+// Publish adds a committed transaction to the mempool.
+func (p *Pending) Publish(ctx context.Context) (*SendResponse, error) {
+	if p.entry == nil {
+		return p.resp, nil
+	}
+	for _, id := range p.replaced {
+		mempool.Default.Remove(id, StatusReplaced)
+	}
+	if err := mempool.Default.Add(p.entry); err != nil {
+		// Lost a race with another submission since the check in SubmitTx.
+		// Outside the pool the transaction would never be mined, so it is undone.
+		if rerr := rejectUnpooled(ctx, p.entry.TxID, err); rerr != nil {
+			log.Printf("mempool add %s: %v; reject: %v", p.entry.TxID, err, rerr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInputsUnavailable, err)
+	}
+	return p.resp, nil
+}
+
+// rejectUnpooled rejects a just-recorded transaction the mempool refused.
+func rejectUnpooled(ctx context.Context, txID string, cause error) error {
+	q, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = q.Rollback(ctx) }()
+	if err := Reject(ctx, q, txID, "mempool: "+cause.Error()); err != nil {
+		return err
+	}
+	return q.Commit(ctx)
+}
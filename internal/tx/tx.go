@@ -3,9 +3,13 @@ package tx
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/wallet"
 )
 
 // ✅ Get details of a specific transaction
@@ -22,18 +26,50 @@ func DetailHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var from, to, status, senderPub, sigR, sigS, note, ts string
+	var from, to, status, senderPub, sigR, sigS, note, ts, rejectReason string
 	var amount, fee int64
+	var sigInvalid bool
+	var height *int
+	var tip int
 	err := dbPool.QueryRow(context.Background(),
-		`SELECT from_wallet_id, to_wallet_id, amount, fee, status,
-                sender_public_key, signature_r, signature_s, note, timestamp
-         FROM transactions WHERE tx_id=$1::uuid`, txID).
-		Scan(&from, &to, &amount, &fee, &status, &senderPub, &sigR, &sigS, &note, &ts)
+		`SELECT t.from_wallet_id, t.to_wallet_id, t.amount, t.fee, t.status,
+                t.sender_public_key, t.signature_r, t.signature_s, t.note, t.timestamp,
+                COALESCE(t.reject_reason,''), b.height, (SELECT COALESCE(MAX(height),-1) FROM blocks),
+                t.signature_invalid
+         FROM transactions t
+         LEFT JOIN blocks b ON b.block_id = t.block_id
+         WHERE t.tx_id=$1::uuid`, txID).
+		Scan(&from, &to, &amount, &fee, &status, &senderPub, &sigR, &sigS, &note, &ts, &rejectReason, &height, &tip, &sigInvalid)
 	if err != nil {
 		http.Error(w, "transaction not found", http.StatusNotFound)
 		return
 	}
 
+	// Status history
+	histRows, err := dbPool.Query(context.Background(),
+		`SELECT COALESCE(from_status,''), to_status, COALESCE(reason,''), changed_at
+         FROM transaction_status_history WHERE tx_id=$1::uuid ORDER BY changed_at, id`, txID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	type H struct {
+		From      string    `json:"from_status,omitempty"`
+		To        string    `json:"to_status"`
+		Reason    string    `json:"reason,omitempty"`
+		ChangedAt time.Time `json:"changed_at"`
+	}
+	var history []H
+	for histRows.Next() {
+		var h H
+		if err := histRows.Scan(&h.From, &h.To, &h.Reason, &h.ChangedAt); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		history = append(history, h)
+	}
+	histRows.Close()
+
 	// Inputs
 	inRows, err := dbPool.Query(context.Background(),
 		`SELECT ti.utxo_id::text, u.amount
@@ -91,9 +127,14 @@ func DetailHandler(w http.ResponseWriter, r *http.Request) {
 		"amount":            amount,
 		"fee":               fee,
 		"status":            status,
+		"reject_reason":     rejectReason,
+		"block_height":      height,
+		"confirmations":     Confirmations(tip, height),
+		"status_history":    history,
 		"sender_public_key": senderPub,
 		"signature_r":       sigR,
 		"signature_s":       sigS,
+		"signature_invalid": sigInvalid,
 		"note":              note,
 		"timestamp":         ts,
 		"inputs":            inputs,
@@ -110,30 +151,34 @@ func WalletTxsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := claims["user_id"].(string)
 
-	walletID := r.URL.Query().Get("wallet_id")
+	walletID, err := address.FromQuery(r, "wallet_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if walletID == "" {
 		http.Error(w, "wallet_id required", http.StatusBadRequest)
 		return
 	}
 
-	// Ownership check
-	var owner string
-	err := dbPool.QueryRow(context.Background(),
-		`SELECT user_id FROM wallets WHERE wallet_id=$1`, walletID).Scan(&owner)
-	if err != nil {
-		http.Error(w, "wallet not found", http.StatusNotFound)
+	// Owners and watchers may read
+	watchOnly, err := wallet.EnsureWalletReadableByUser(dbPool, walletID, userID)
+	if errors.Is(err, wallet.ErrWalletNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	if owner != userID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
 	rows, err := dbPool.Query(context.Background(),
-		`SELECT tx_id::text, from_wallet_id, to_wallet_id, amount, fee, status, note, timestamp, created_at
-         FROM transactions
-         WHERE from_wallet_id=$1 OR to_wallet_id=$1
-         ORDER BY created_at DESC`, walletID)
+		`SELECT t.tx_id::text, t.from_wallet_id, t.to_wallet_id, t.amount, t.fee, t.status, t.note, t.timestamp, t.created_at,
+                COALESCE((SELECT MAX(height) FROM blocks) - b.height + 1, 0)
+         FROM transactions t
+         LEFT JOIN blocks b ON b.block_id = t.block_id
+         WHERE t.from_wallet_id=$1 OR t.to_wallet_id=$1
+         ORDER BY t.created_at DESC`, walletID)
 	if err != nil {
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
@@ -144,26 +189,48 @@ func WalletTxsHandler(w http.ResponseWriter, r *http.Request) {
 		TxID      string `json:"tx_id"`
 		From      string `json:"from_wallet_id"`
 		To        string `json:"to_wallet_id"`
+		FromAddr  string `json:"from_address"`
+		ToAddr    string `json:"to_address"`
 		Amount    int64  `json:"amount"`
 		Fee       int64  `json:"fee"`
 		Status    string `json:"status"`
 		Note      string `json:"note"`
 		Timestamp string `json:"timestamp"`
 		Created   string `json:"created_at"`
+		Confirms  int    `json:"confirmations"`
+
+		Counterparty string `json:"counterparty,omitempty"` // contact name or own wallet label
 	}
 	var list []T
 	for rows.Next() {
 		var t T
-		if err := rows.Scan(&t.TxID, &t.From, &t.To, &t.Amount, &t.Fee, &t.Status, &t.Note, &t.Timestamp, &t.Created); err != nil {
+		if err := rows.Scan(&t.TxID, &t.From, &t.To, &t.Amount, &t.Fee, &t.Status, &t.Note, &t.Timestamp, &t.Created, &t.Confirms); err != nil {
 			http.Error(w, "scan error", http.StatusInternalServerError)
 			return
 		}
 		list = append(list, t)
 	}
 
+	// Name the other side of each transaction from the address book
+	var others []string
+	for _, t := range list {
+		others = append(others, wallet.Counterparty(walletID, t.From, t.To))
+	}
+	names, err := wallet.CounterpartyNames(context.Background(), userID, others)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	for i, t := range list {
+		list[i].FromAddr, list[i].ToAddr = address.For(t.From), address.For(t.To)
+		list[i].Counterparty = names[wallet.Counterparty(walletID, t.From, t.To)]
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"wallet_id":    walletID,
+		"address":      address.For(walletID),
+		"watch_only":   watchOnly,
 		"transactions": list,
 	})
 }
@@ -0,0 +1,328 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/fee"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/invoice"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/mempool"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/sigverify"
+)
+
+// Record is a stored transaction with its inputs and outputs.
+type Record struct {
+	TxID       string
+	From       string
+	To         string
+	Amount     int64
+	Fee        int64
+	Kind       string
+	SenderPub  string
+	SigR       string
+	SigS       string
+	Note       string
+	Timestamp  string
+	MandateID  string
+	Flagged    bool // its signature or its mandate's was flagged invalid by sigmigrate
+	Inputs     []Input
+	Outputs    []Output
+	InputTotal int64
+}
+
+// Input is a UTXO consumed by a transaction, as it currently stands in the UTXO set.
+type Input struct {
+	UTXOID   string
+	WalletID string
+	Amount   int64
+	Spent    bool
+	Missing  bool   // the UTXO row no longer exists
+	SourceTx string // transaction that created the UTXO, empty for genesis outputs
+}
+
+// LoadRecord reads a transaction together with its inputs and outputs.
+func LoadRecord(ctx context.Context, q pgx.Tx, txID string) (*Record, error) {
+	rec := &Record{TxID: txID}
+	err := q.QueryRow(ctx,
+		`SELECT from_wallet_id, to_wallet_id, amount, fee, kind,
+                COALESCE(sender_public_key,''), COALESCE(signature_r,''), COALESCE(signature_s,''),
+                COALESCE(note,''), COALESCE(timestamp::text,''), COALESCE(mandate_id::text,''),
+                signature_invalid OR EXISTS (
+                    SELECT 1 FROM payment_mandates m WHERE m.mandate_id = transactions.mandate_id AND m.signature_invalid)
+         FROM transactions WHERE tx_id=$1::uuid`, txID).
+		Scan(&rec.From, &rec.To, &rec.Amount, &rec.Fee, &rec.Kind,
+			&rec.SenderPub, &rec.SigR, &rec.SigS, &rec.Note, &rec.Timestamp, &rec.MandateID, &rec.Flagged)
+	if err != nil {
+		return nil, fmt.Errorf("load transaction %s: %w", txID, err)
+	}
+
+	inRows, err := q.Query(ctx,
+		`SELECT ti.utxo_id::text, u.utxo_id IS NULL, COALESCE(u.wallet_id,''), COALESCE(u.amount,0),
+                COALESCE(u.spent,false), COALESCE(u.tx_id::text,'')
+         FROM transaction_inputs ti
+         LEFT JOIN utxos u ON u.utxo_id = ti.utxo_id
+         WHERE ti.tx_id=$1::uuid`, txID)
+	if err != nil {
+		return nil, fmt.Errorf("load inputs %s: %w", txID, err)
+	}
+	for inRows.Next() {
+		var in Input
+		if err := inRows.Scan(&in.UTXOID, &in.Missing, &in.WalletID, &in.Amount, &in.Spent, &in.SourceTx); err != nil {
+			inRows.Close()
+			return nil, fmt.Errorf("scan inputs %s: %w", txID, err)
+		}
+		rec.Inputs = append(rec.Inputs, in)
+		rec.InputTotal += in.Amount
+	}
+	inRows.Close()
+
+	outRows, err := q.Query(ctx,
+		`SELECT wallet_id, amount, output_index FROM transaction_outputs
+         WHERE tx_id=$1::uuid ORDER BY output_index`, txID)
+	if err != nil {
+		return nil, fmt.Errorf("load outputs %s: %w", txID, err)
+	}
+	for outRows.Next() {
+		var o Output
+		if err := outRows.Scan(&o.WalletID, &o.Amount, &o.Index); err != nil {
+			outRows.Close()
+			return nil, fmt.Errorf("scan outputs %s: %w", txID, err)
+		}
+		rec.Outputs = append(rec.Outputs, o)
+	}
+	outRows.Close()
+	return rec, nil
+}
+
+// PendingParents lists still-pending transactions whose outputs txID spends.
+func PendingParents(ctx context.Context, q pgx.Tx, txID string) ([]string, error) {
+	rows, err := q.Query(ctx,
+		`SELECT DISTINCT p.tx_id::text
+         FROM transaction_inputs ti
+         JOIN utxos u ON u.utxo_id = ti.utxo_id
+         JOIN transactions p ON p.tx_id = u.tx_id
+         WHERE ti.tx_id=$1::uuid AND p.status='pending'`, txID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// SignedPayload rebuilds the bytes the sender signed: the mandate for mandate
+// executions, the canonical transfer payload otherwise.
+func (rec *Record) SignedPayload(ctx context.Context, q pgx.Tx) (string, error) {
+	if rec.MandateID == "" {
+		return CanonicalPayload(rec.From, rec.To, rec.Amount, rec.Timestamp, rec.Note), nil
+	}
+	var from, to, interval, ts, note string
+	var amount int64
+	var startAt time.Time
+	err := q.QueryRow(ctx,
+		`SELECT from_wallet_id, to_wallet_id, amount, interval, start_at, timestamp, note
+         FROM payment_mandates WHERE mandate_id=$1::uuid`, rec.MandateID).
+		Scan(&from, &to, &amount, &interval, &startAt, &ts, &note)
+	if err != nil {
+		return "", errors.New("mandate not found")
+	}
+	if from != rec.From || to != rec.To || amount != rec.Amount {
+		return "", errors.New("transaction does not match its mandate")
+	}
+	return MandatePayload(from, to, amount, interval, startAt.UTC().Format(time.RFC3339), ts, note), nil
+}
+
+// SignatureJobs loads the signature checks for the given transactions in one
+// query, for batch verification with sigverify. System transactions carry no
+// signature and are skipped. Each job verifies against the sender wallet's
+// key, so a transaction signed by any other key fails.
+func SignatureJobs(ctx context.Context, q Querier, txIDs []string) ([]sigverify.Job, error) {
+	rows, err := q.Query(ctx,
+		`SELECT t.tx_id::text, t.from_wallet_id, t.to_wallet_id, t.amount,
+                COALESCE(t.timestamp::text,''), COALESCE(t.note,''),
+                COALESCE(t.signature_r,''), COALESCE(t.signature_s,''), COALESCE(w.public_key,''), COALESCE(w.key_type,''),
+                m.mandate_id IS NOT NULL, COALESCE(m.from_wallet_id,''), COALESCE(m.to_wallet_id,''),
+                COALESCE(m.amount,0), COALESCE(m.interval,''), m.start_at,
+                COALESCE(m.timestamp,''), COALESCE(m.note,'')
+         FROM transactions t
+         LEFT JOIN wallets w ON w.wallet_id = t.from_wallet_id
+         LEFT JOIN payment_mandates m ON m.mandate_id = t.mandate_id
+         WHERE t.tx_id = ANY($1::uuid[]) AND t.kind <> $2`, txIDs, KindSystem)
+	if err != nil {
+		return nil, fmt.Errorf("load signatures: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []sigverify.Job
+	for rows.Next() {
+		var j sigverify.Job
+		var from, to, ts, note string
+		var amount int64
+		var hasMandate bool
+		var mFrom, mTo, mInterval, mTs, mNote string
+		var mAmount int64
+		var mStart *time.Time
+		if err := rows.Scan(&j.ID, &from, &to, &amount, &ts, &note, &j.R, &j.S, &j.PubKey, &j.KeyType,
+			&hasMandate, &mFrom, &mTo, &mAmount, &mInterval, &mStart, &mTs, &mNote); err != nil {
+			return nil, fmt.Errorf("scan signatures: %w", err)
+		}
+		switch {
+		case !hasMandate:
+			j.Payload = []byte(CanonicalPayload(from, to, amount, ts, note))
+		case mStart != nil && mFrom == from && mTo == to && mAmount == amount:
+			j.Payload = []byte(MandatePayload(mFrom, mTo, mAmount, mInterval, mStart.UTC().Format(time.RFC3339), mTs, mNote))
+		}
+		// a transaction that does not match its mandate keeps an empty payload and fails
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Verify re-checks a pending transaction against the current UTXO set.
+// The returned error is the rejection reason; it is nil for a valid transaction.
+func (rec *Record) Verify(ctx context.Context, q pgx.Tx) error {
+	if rec.Kind != KindSystem {
+		if rec.SenderPub == "" || rec.SigR == "" || rec.SigS == "" {
+			return errors.New("missing signature")
+		}
+		if rec.Flagged {
+			return errors.New("signature flagged invalid")
+		}
+		var walletPub, keyType string
+		if err := q.QueryRow(ctx,
+			`SELECT public_key, key_type FROM wallets WHERE wallet_id=$1`, rec.From).Scan(&walletPub, &keyType); err != nil {
+			return errors.New("sender wallet not found")
+		}
+		if walletPub != rec.SenderPub {
+			return errors.New("sender public key does not match wallet")
+		}
+		if _, err := crypto.ParsePublicKey(keyType, rec.SenderPub); err != nil {
+			return errors.New("invalid sender public key")
+		}
+		payload, err := rec.SignedPayload(ctx, q)
+		if err != nil {
+			return err
+		}
+		job := sigverify.Job{ID: rec.TxID, KeyType: keyType, PubKey: rec.SenderPub, Payload: []byte(payload), R: rec.SigR, S: rec.SigS}
+		if !sigverify.Default.Verify(job).Valid {
+			return errors.New("invalid signature")
+		}
+	}
+
+	if len(rec.Inputs) == 0 {
+		return errors.New("no inputs")
+	}
+	for _, in := range rec.Inputs {
+		if in.Missing {
+			return fmt.Errorf("input %s does not exist", in.UTXOID)
+		}
+		if in.WalletID != rec.From {
+			return fmt.Errorf("input %s is not owned by sender", in.UTXOID)
+		}
+		if !in.Spent {
+			return fmt.Errorf("input %s is not reserved by this transaction", in.UTXOID)
+		}
+		if in.SourceTx != "" {
+			var srcStatus string
+			if err := q.QueryRow(ctx,
+				`SELECT status FROM transactions WHERE tx_id=$1::uuid`, in.SourceTx).Scan(&srcStatus); err != nil {
+				return fmt.Errorf("input %s source transaction not found", in.UTXOID)
+			}
+			if srcStatus == StatusRejected || srcStatus == StatusExpired || srcStatus == StatusReplaced {
+				return fmt.Errorf("input %s comes from a %s transaction", in.UTXOID, srcStatus)
+			}
+		}
+		var others int
+		if err := q.QueryRow(ctx,
+			`SELECT COUNT(*) FROM transaction_inputs ti
+             JOIN transactions t ON t.tx_id = ti.tx_id
+             WHERE ti.utxo_id=$1::uuid AND ti.tx_id<>$2::uuid AND t.status NOT IN `+dropped,
+			in.UTXOID, rec.TxID).Scan(&others); err != nil {
+			return fmt.Errorf("input %s double-spend check failed", in.UTXOID)
+		}
+		if others > 0 {
+			return fmt.Errorf("input %s is double-spent", in.UTXOID)
+		}
+	}
+
+	if rec.Amount <= 0 || rec.Fee < 0 {
+		return errors.New("invalid amount or fee")
+	}
+	var outTotal int64
+	for _, o := range rec.Outputs {
+		if o.Amount <= 0 {
+			return fmt.Errorf("output %d has non-positive amount", o.Index)
+		}
+		outTotal += o.Amount
+	}
+	if len(rec.Outputs) == 0 || rec.Outputs[0].WalletID != rec.To || rec.Outputs[0].Amount != rec.Amount {
+		return errors.New("recipient output does not match amount")
+	}
+	if rec.InputTotal != outTotal+rec.Fee {
+		return fmt.Errorf("inputs %d do not balance outputs %d plus fee %d", rec.InputTotal, outTotal, rec.Fee)
+	}
+
+	tier := "standard"
+	_ = q.QueryRow(ctx, `SELECT tier FROM wallets WHERE wallet_id=$1`, rec.From).Scan(&tier)
+	return fee.Current().Check(rec.Fee, fee.Params{
+		Size:   mempool.EstimateSize(len(rec.Inputs), len(rec.Outputs)),
+		Amount: rec.Amount,
+		Tier:   tier,
+		System: rec.Kind == KindSystem,
+	})
+}
+
+// Reject marks a pending transaction rejected and unwinds its effect on the
+// UTXO set: reserved inputs are released and unspent outputs are removed.
+func Reject(ctx context.Context, q pgx.Tx, txID, reason string) error {
+	return drop(ctx, q, txID, StatusRejected, reason)
+}
+
+// dropped lists the statuses of transactions that never made it into a block.
+const dropped = `('rejected','expired','replaced')`
+
+// drop moves a pending transaction to a terminal non-block status and unwinds
+// its effect on the UTXO set.
+func drop(ctx context.Context, q pgx.Tx, txID, status, reason string) error {
+	if err := SetStatus(ctx, q, txID, status, reason, ""); err != nil {
+		return err
+	}
+	// Release inputs nobody else holds, unless they came from a dropped transaction themselves.
+	if _, err := q.Exec(ctx,
+		`UPDATE utxos u SET spent=false
+         FROM transaction_inputs ti
+         WHERE ti.tx_id=$1::uuid AND u.utxo_id = ti.utxo_id
+           AND NOT EXISTS (
+               SELECT 1 FROM transaction_inputs o JOIN transactions t ON t.tx_id = o.tx_id
+               WHERE o.utxo_id = u.utxo_id AND o.tx_id <> $1::uuid AND t.status NOT IN `+dropped+`)
+           AND NOT EXISTS (
+               SELECT 1 FROM transactions src WHERE src.tx_id = u.tx_id AND src.status IN `+dropped+`)`,
+		txID); err != nil {
+		return fmt.Errorf("release inputs %s: %w", txID, err)
+	}
+	// Outputs nobody references are removed; referenced ones are kept as spent
+	// so history stays intact, and their spender fails validation on its source.
+	if _, err := q.Exec(ctx,
+		`DELETE FROM utxos u WHERE u.tx_id=$1::uuid
+           AND NOT EXISTS (SELECT 1 FROM transaction_inputs ti WHERE ti.utxo_id = u.utxo_id)`, txID); err != nil {
+		return fmt.Errorf("remove outputs %s: %w", txID, err)
+	}
+	if _, err := q.Exec(ctx,
+		`UPDATE utxos SET spent=true WHERE tx_id=$1::uuid`, txID); err != nil {
+		return fmt.Errorf("retire outputs %s: %w", txID, err)
+	}
+	// An invoice it paid is owed again.
+	return invoice.ReversePayment(ctx, q, txID)
+}
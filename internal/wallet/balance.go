@@ -0,0 +1,52 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Balance breaks a wallet's funds down by confirmation state.
+//
+// Total is every unspent output, as balances were reported before.
+// Confirmed outputs come from transactions at least the confirmation depth
+// deep; UnconfirmedIncoming are outputs, change included, of transactions
+// that are pending or not yet deep enough. UnconfirmedOutgoing is what the
+// wallet's own unconfirmed transactions send away, fee included. Locked
+// outputs are earmarked as inputs of open partially signed transactions;
+// they are also counted in Confirmed or UnconfirmedIncoming.
+type Balance struct {
+	Total               int64 `json:"balance"`
+	Confirmed           int64 `json:"confirmed"`
+	UnconfirmedIncoming int64 `json:"unconfirmed_incoming"`
+	UnconfirmedOutgoing int64 `json:"unconfirmed_outgoing"`
+	Locked              int64 `json:"locked"`
+}
+
+// WalletBalance computes the breakdown for one wallet.
+func WalletBalance(ctx context.Context, pool *pgxpool.Pool, walletID string) (Balance, error) {
+	var b Balance
+	err := pool.QueryRow(ctx,
+		`SELECT
+            COALESCE(SUM(u.amount), 0),
+            COALESCE(SUM(u.amount) FILTER (WHERE t.tx_id IS NULL OR t.status = 'confirmed'), 0),
+            COALESCE(SUM(u.amount) FILTER (WHERE t.tx_id IS NOT NULL AND t.status <> 'confirmed'), 0),
+            COALESCE(SUM(u.amount) FILTER (WHERE EXISTS (
+                SELECT 1 FROM partial_transactions p, jsonb_array_elements(p.packet->'inputs') i
+                WHERE p.from_wallet_id = u.wallet_id AND p.status = 'open'
+                  AND i->>'utxo_id' = u.utxo_id::text)), 0)
+         FROM utxos u
+         LEFT JOIN transactions t ON t.tx_id = u.tx_id
+         WHERE u.wallet_id=$1 AND u.spent=false`, walletID).
+		Scan(&b.Total, &b.Confirmed, &b.UnconfirmedIncoming, &b.Locked)
+	if err != nil {
+		return b, err
+	}
+	// Self-transfers only send the fee away
+	err = pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(CASE WHEN to_wallet_id = from_wallet_id THEN fee ELSE amount + fee END), 0)
+         FROM transactions
+         WHERE from_wallet_id=$1 AND status IN ('pending','committed')`, walletID).
+		Scan(&b.UnconfirmedOutgoing)
+	return b, err
+}
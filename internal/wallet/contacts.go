@@ -0,0 +1,175 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+)
+
+var ErrContactNotFound = errors.New("contact not found")
+
+type ContactRequest struct {
+	Name     string `json:"name"`
+	WalletID string `json:"wallet_id"`
+	Note     string `json:"note"`
+}
+
+type Contact struct {
+	ContactID string    `json:"contact_id"`
+	Name      string    `json:"name"`
+	WalletID  string    `json:"wallet_id"`
+	Address   string    `json:"address"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ✅ List, add or remove address book contacts
+//
+// GET lists contacts, POST adds or renames one by name, DELETE ?name= removes one.
+func ContactsHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+	ctx := context.Background()
+
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := dbPool.Query(ctx,
+			`SELECT contact_id::text, name, wallet_id, note, created_at
+             FROM contacts WHERE user_id=$1 ORDER BY lower(name)`, userID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		list := []Contact{}
+		for rows.Next() {
+			var c Contact
+			if err := rows.Scan(&c.ContactID, &c.Name, &c.WalletID, &c.Note, &c.CreatedAt); err != nil {
+				http.Error(w, "scan error", http.StatusInternalServerError)
+				return
+			}
+			c.Address = address.For(c.WalletID)
+			list = append(list, c)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"contacts": list})
+
+	case http.MethodPost:
+		var req ContactRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := address.Normalize(&req.WalletID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > maxLabelLen || req.WalletID == "" {
+			http.Error(w, "name and wallet_id required", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		if err := dbPool.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM wallets WHERE wallet_id=$1)`, req.WalletID).Scan(&exists); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "wallet not found", http.StatusBadRequest)
+			return
+		}
+		var c Contact
+		if err := dbPool.QueryRow(ctx,
+			`INSERT INTO contacts (user_id, name, wallet_id, note) VALUES ($1,$2,$3,$4)
+             ON CONFLICT (user_id, lower(name)) DO UPDATE SET name=$2, wallet_id=$3, note=$4
+             RETURNING contact_id::text, name, wallet_id, note, created_at`,
+			userID, req.Name, req.WalletID, req.Note).
+			Scan(&c.ContactID, &c.Name, &c.WalletID, &c.Note, &c.CreatedAt); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		c.Address = address.For(c.WalletID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		tag, err := dbPool.Exec(ctx,
+			`DELETE FROM contacts WHERE user_id=$1 AND lower(name)=lower($2)`, userID, name)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			http.Error(w, ErrContactNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ResolveContact returns the wallet of the user's contact with this name.
+func ResolveContact(ctx context.Context, userID, name string) (string, error) {
+	var walletID string
+	err := dbPool.QueryRow(ctx,
+		`SELECT wallet_id FROM contacts WHERE user_id=$1 AND lower(name)=lower($2)`,
+		userID, strings.TrimSpace(name)).Scan(&walletID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrContactNotFound
+	}
+	return walletID, err
+}
+
+// CounterpartyNames names the given wallets for userID: the contact name if
+// the wallet is in the address book, otherwise the label of the user's own
+// wallet. Unnamed wallets are left out.
+func CounterpartyNames(ctx context.Context, userID string, walletIDs []string) (map[string]string, error) {
+	names := map[string]string{}
+	if len(walletIDs) == 0 {
+		return names, nil
+	}
+	rows, err := dbPool.Query(ctx,
+		`SELECT wallet_id, label, 0 FROM wallets
+         WHERE user_id=$1 AND wallet_id = ANY($2) AND label <> ''
+         UNION ALL
+         SELECT wallet_id, name, 1 FROM contacts
+         WHERE user_id=$1 AND wallet_id = ANY($2)
+         ORDER BY 3`, userID, walletIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		var rank int
+		if err := rows.Scan(&id, &name, &rank); err != nil {
+			return nil, err
+		}
+		names[id] = name // contacts come last and win
+	}
+	return names, rows.Err()
+}
+
+// Counterparty is the wallet on the other side of a transfer seen from walletID.
+func Counterparty(walletID, from, to string) string {
+	if from == walletID {
+		return to
+	}
+	return from
+}
@@ -3,11 +3,17 @@ package wallet
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
-	"time"
 
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/hd"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -17,6 +23,11 @@ func Init(pool *pgxpool.Pool) {
 	dbPool = pool
 }
 
+type CreateRequest struct {
+	Passphrase string `json:"passphrase"` // optional; needed again to use the key and, for HD users, to open the seed
+	KeyType    string `json:"key_type"`   // optional: ECDSA_P256 (default), ECDSA_SECP256K1 or ED25519
+}
+
 func CreateHandler(w http.ResponseWriter, r *http.Request) {
 	claims := auth.GetClaims(r)
 	if claims == nil {
@@ -25,52 +36,172 @@ func CreateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := claims["user_id"].(string)
 
-	// ✅ Generate ECDSA keypair
-	priv, pub, err := crypto.GenerateKeypair()
+	// Optional body; without a passphrase the key is wrapped by the master key
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	kt, err := crypto.LookupKeyType(req.KeyType)
 	if err != nil {
-		http.Error(w, "failed to generate keypair", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// ✅ Serialize public key
-	pubHex := crypto.SerializePublicKey(pub)
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
 
-	// ✅ Wallet ID = SHA-256 hash of public key
-	walletID := crypto.WalletHashFromPublicKeyHex(pubHex)
+	walletID, pubHex, hdIndex, err := newWallet(ctx, dbTx, userID, kt, req.Passphrase)
+	if errors.Is(err, envelope.ErrWrongPassphrase) {
+		http.Error(w, "wrong passphrase for HD seed", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, envelope.ErrPassphrase) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, envelope.ErrNoMasterKey) {
+		log.Printf("wallet create: %v", err)
+		http.Error(w, "encryption error", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		log.Printf("wallet create: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	protection := envelope.WrapMaster
+	if req.Passphrase != "" {
+		protection = envelope.WrapPassphrase
+	}
 
-	// ✅ Serialize private key (D scalar, padded to 32 bytes)
-	dBytes := priv.D.Bytes()
-	if len(dBytes) < 32 {
-		padded := make([]byte, 32)
-		copy(padded[32-len(dBytes):], dBytes)
-		dBytes = padded
+	// ✅ Respond with wallet info
+	resp := map[string]any{
+		"wallet_id":      walletID,
+		"address":        address.For(walletID),
+		"public_key":     pubHex,
+		"key_type":       kt.Name(),
+		"key_protection": protection,
+	}
+	if hdIndex != nil {
+		resp["hd_index"] = *hdIndex
+		resp["path"] = hd.PathString(hd.WalletPath(uint32(*hdIndex)))
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
-	// ✅ Encrypt private key with AES-GCM
-	// For demo: derive key from userID (replace with PBKDF2/Argon2 in production)
-	aesKey := make([]byte, 32)
-	copy(aesKey, []byte(userID))
-	encPriv, err := crypto.EncryptBytesAESGCM(aesKey, dBytes)
-	if err != nil {
-		http.Error(w, "encryption error", http.StatusInternalServerError)
+// newWallet creates a custodial wallet of key type kt for userID inside q.
+func newWallet(ctx context.Context, q pgx.Tx, userID string, kt crypto.KeyType, passphrase string) (string, string, *int, error) {
+	// ✅ Generate the keypair: for P-256, the next child of the user's HD seed
+	// if they have one; otherwise (and for other key types) a random key
+	if kt.Name() != crypto.KeyTypeP256 {
+		priv, err := kt.Generate()
+		if err != nil {
+			return "", "", nil, err
+		}
+		walletID, pubHex, err := insertWallet(ctx, q, userID, priv, passphrase, nil)
+		return walletID, pubHex, nil, err
+	}
+	var hdIndex *int
+	var priv crypto.PrivateKey
+	hdKey, index, err := nextHDKey(ctx, q, userID, passphrase)
+	switch {
+	case errors.Is(err, errNoSeed):
+		if priv, err = kt.Generate(); err != nil {
+			return "", "", nil, err
+		}
+	case err != nil:
+		return "", "", nil, err
+	default:
+		priv, hdIndex = crypto.FromECDSA(hdKey), &index
+	}
+
+	// ✅ Wallet ID = SHA-256 hash of public key; the private key is
+	// envelope-encrypted under the passphrase or the server master key
+	walletID, pubHex, err := insertWallet(ctx, q, userID, priv, passphrase, hdIndex)
+	return walletID, pubHex, hdIndex, err
+}
+
+type PassphraseRequest struct {
+	WalletID      string `json:"wallet_id"`
+	OldPassphrase string `json:"old_passphrase"` // empty for master-wrapped keys
+	NewPassphrase string `json:"new_passphrase"` // empty to wrap with the master key
+}
+
+// ✅ Change how a wallet key is protected; only the data key is re-wrapped
+func PassphraseHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID, _ := claims["user_id"].(string)
 
-	// ✅ Insert into DB
-	_, err = dbPool.Exec(context.Background(),
-		`INSERT INTO wallets (wallet_id, user_id, public_key, private_key_enc, key_type, wallet_hash, created_at)
-         VALUES ($1,$2,$3,$4,$5,$6,$7)`,
-		walletID, userID, pubHex, encPriv, "ECDSA_P256", walletID, time.Now())
+	var req PassphraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WalletID == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := address.Normalize(&req.WalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := EnsureWalletOwnedByUser(dbPool, req.WalletID, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	var enc *string
+	if err := dbPool.QueryRow(ctx,
+		`SELECT private_key_enc FROM wallets WHERE wallet_id=$1`, req.WalletID).Scan(&enc); err != nil {
+		http.Error(w, "wallet not found", http.StatusNotFound)
+		return
+	}
+	if enc == nil || !envelope.IsEnvelope(*enc) {
+		http.Error(w, "wallet key is not held in an envelope", http.StatusConflict)
+		return
+	}
+
+	rewrapped, err := envelope.Rewrap(*enc, req.OldPassphrase, req.NewPassphrase)
+	if errors.Is(err, envelope.ErrWrongPassphrase) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, envelope.ErrPassphrase) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
+		log.Printf("wallet passphrase: %v", err)
+		http.Error(w, "encryption error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := dbPool.Exec(ctx,
+		`UPDATE wallets SET private_key_enc=$2 WHERE wallet_id=$1`, req.WalletID, rewrapped); err != nil {
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
 	}
 
-	// ✅ Respond with wallet info
+	protection := envelope.WrapMaster
+	if req.NewPassphrase != "" {
+		protection = envelope.WrapPassphrase
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"wallet_id":  walletID,
-		"public_key": pubHex,
-		"key_type":   "ECDSA_P256",
+		"wallet_id":      req.WalletID,
+		"address":        address.For(req.WalletID),
+		"key_protection": protection,
 	})
 }
@@ -0,0 +1,359 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/hd"
+)
+
+var (
+	errNoSeed        = errors.New("user has no HD seed")
+	errSeedMismatch  = errors.New("a different seed is already set up for this account")
+	errForeignWallet = errors.New("a derived wallet belongs to another account")
+)
+
+// maxRecoverScan bounds how many indexes recovery derives.
+const maxRecoverScan = 1000
+
+type HDInitRequest struct {
+	Passphrase string `json:"passphrase"` // optional; protects the seed and its wallets
+	Words      int    `json:"words"`      // 12 (default) or 24
+}
+
+type HDRecoverRequest struct {
+	Mnemonic   string `json:"mnemonic"`
+	Passphrase string `json:"passphrase"` // optional; protects the seed and all its wallets from now on
+	Count      int    `json:"count"`      // regenerate at least this many wallets
+	Gap        int    `json:"gap"`        // stop after this many unused indexes; default 20
+}
+
+type RecoveredWallet struct {
+	WalletID  string `json:"wallet_id"`
+	Address   string `json:"address"`
+	PublicKey string `json:"public_key"`
+	Index     int    `json:"hd_index"`
+	Path      string `json:"path"`
+	Existing  bool   `json:"existing"` // the wallet was already on file
+}
+
+// insertWallet stores a new custodial wallet for priv, envelope-encrypting
+// the key. hdIndex is nil for random keys.
+func insertWallet(ctx context.Context, q pgx.Tx, userID string, priv crypto.PrivateKey, passphrase string, hdIndex *int) (string, string, error) {
+	pub := priv.Public()
+	pubHex := pub.Hex()
+	walletID := crypto.WalletHashFromPublicKeyHex(pubHex)
+	encPriv, err := envelope.Seal(priv.Bytes(), passphrase)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = q.Exec(ctx,
+		`INSERT INTO wallets (wallet_id, user_id, public_key, private_key_enc, key_type, wallet_hash, created_at, hd_index)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		walletID, userID, pubHex, encPriv, pub.KeyType(), walletID, time.Now(), hdIndex)
+	return walletID, pubHex, err
+}
+
+// nextHDKey derives the user's next wallet key and advances the seed's
+// index. It returns errNoSeed for users without a seed.
+func nextHDKey(ctx context.Context, q pgx.Tx, userID, passphrase string) (*ecdsa.PrivateKey, int, error) {
+	var seedEnc string
+	var index int
+	err := q.QueryRow(ctx,
+		`SELECT seed_enc, next_index FROM user_seeds WHERE user_id=$1 FOR UPDATE`, userID).
+		Scan(&seedEnc, &index)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, errNoSeed
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	seed, err := envelope.Open(seedEnc, passphrase)
+	if err != nil {
+		return nil, 0, err
+	}
+	priv, err := hd.WalletKey(seed, uint32(index))
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := q.Exec(ctx,
+		`UPDATE user_seeds SET next_index=$2 WHERE user_id=$1`, userID, index+1); err != nil {
+		return nil, 0, err
+	}
+	return priv, index, nil
+}
+
+// ✅ Set up a mnemonic-backed seed; later wallets are derived from it
+func HDInitHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req HDInitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	mnemonic, err := hd.NewMnemonic(req.Words)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	seed, err := hd.SeedFromMnemonic(mnemonic)
+	if err != nil {
+		http.Error(w, "seed error", http.StatusInternalServerError)
+		return
+	}
+	fingerprint, err := hd.Fingerprint(seed)
+	if err != nil {
+		http.Error(w, "seed error", http.StatusInternalServerError)
+		return
+	}
+	seedEnc, err := envelope.Seal(seed, req.Passphrase)
+	if errors.Is(err, envelope.ErrPassphrase) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("hd init: %v", err)
+		http.Error(w, "encryption error", http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := dbPool.Exec(context.Background(),
+		`INSERT INTO user_seeds (user_id, seed_enc, fingerprint) VALUES ($1,$2,$3)
+         ON CONFLICT (user_id) DO NOTHING`, userID, seedEnc, fingerprint)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "seed already set up", http.StatusConflict)
+		return
+	}
+
+	// The mnemonic is shown once and never stored in clear.
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"mnemonic":    mnemonic,
+		"fingerprint": fingerprint,
+		"path":        hd.PathString(hd.WalletPath(0)),
+	})
+}
+
+// ✅ Restore a seed from its mnemonic and regenerate the wallets derived from it
+func HDRecoverHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req HDRecoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Mnemonic == "" || req.Count < 0 || req.Gap < 0 {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Gap == 0 {
+		req.Gap = 20
+	}
+	req.Count = min(req.Count, maxRecoverScan)
+
+	seed, err := hd.SeedFromMnemonic(req.Mnemonic)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fingerprint, err := hd.Fingerprint(seed)
+	if err != nil {
+		http.Error(w, "seed error", http.StatusInternalServerError)
+		return
+	}
+	seedEnc, err := envelope.Seal(seed, req.Passphrase)
+	if errors.Is(err, envelope.ErrPassphrase) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("hd recover: %v", err)
+		http.Error(w, "encryption error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+
+	var onFile string
+	nextIndex := 0
+	err = dbTx.QueryRow(ctx,
+		`SELECT fingerprint, next_index FROM user_seeds WHERE user_id=$1 FOR UPDATE`, userID).
+		Scan(&onFile, &nextIndex)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if onFile != "" && onFile != fingerprint {
+		http.Error(w, errSeedMismatch.Error(), http.StatusConflict)
+		return
+	}
+
+	wallets, err := recoverWallets(ctx, dbTx, userID, seed, req)
+	if errors.Is(err, errForeignWallet) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("hd recover: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if n := len(wallets); n > 0 {
+		nextIndex = max(nextIndex, wallets[n-1].Index+1)
+	}
+	// The seed is stored under the new passphrase, so its wallets must be too
+	if err := rewrapHDWallets(ctx, dbTx, userID, seed, req.Passphrase); err != nil {
+		log.Printf("hd recover: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := dbTx.Exec(ctx,
+		`INSERT INTO user_seeds (user_id, seed_enc, fingerprint, next_index) VALUES ($1,$2,$3,$4)
+         ON CONFLICT (user_id) DO UPDATE SET seed_enc=$2, next_index=$4`,
+		userID, seedEnc, fingerprint, nextIndex); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"fingerprint": fingerprint,
+		"next_index":  nextIndex,
+		"wallets":     wallets,
+	})
+}
+
+// recoverWallets derives wallets in index order. An index is in use when its
+// wallet is on file or its wallet ID appears in any transaction or output, so
+// wallets whose rows were lost but whose funds remain are found again. Missing
+// wallets that are in use or below req.Count are recreated, and the scan stops
+// after req.Gap consecutive unused indexes past req.Count.
+func recoverWallets(ctx context.Context, q pgx.Tx, userID string, seed []byte, req HDRecoverRequest) ([]RecoveredWallet, error) {
+	var out []RecoveredWallet
+	lastUsed := -1
+	for i := 0; i < maxRecoverScan; i++ {
+		if i >= req.Count && i-lastUsed > req.Gap {
+			break
+		}
+		priv, err := hd.WalletKey(seed, uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		pubHex := crypto.SerializePublicKey(&priv.PublicKey)
+		walletID := crypto.WalletHashFromPublicKeyHex(pubHex)
+		rw := RecoveredWallet{WalletID: walletID, Address: address.For(walletID), PublicKey: pubHex, Index: i, Path: hd.PathString(hd.WalletPath(uint32(i)))}
+
+		var owner string
+		err = q.QueryRow(ctx, `SELECT user_id FROM wallets WHERE wallet_id=$1`, walletID).Scan(&owner)
+		switch {
+		case err == nil && owner != userID:
+			return nil, errForeignWallet
+		case err == nil:
+			// Its key is re-sealed by rewrapHDWallets
+			if _, err := q.Exec(ctx, `UPDATE wallets SET hd_index=$2 WHERE wallet_id=$1`, walletID, i); err != nil {
+				return nil, err
+			}
+			rw.Existing = true
+		case errors.Is(err, pgx.ErrNoRows):
+			seen := i < req.Count
+			if !seen {
+				if err := q.QueryRow(ctx,
+					`SELECT EXISTS (SELECT 1 FROM transaction_outputs WHERE wallet_id=$1)
+                         OR EXISTS (SELECT 1 FROM transactions WHERE from_wallet_id=$1 OR to_wallet_id=$1)
+                         OR EXISTS (SELECT 1 FROM utxos WHERE wallet_id=$1)`, walletID).Scan(&seen); err != nil {
+					return nil, err
+				}
+			}
+			if !seen {
+				continue
+			}
+			index := i
+			if _, _, err := insertWallet(ctx, q, userID, crypto.FromECDSA(priv), req.Passphrase, &index); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, err
+		}
+		lastUsed = i
+		out = append(out, rw)
+	}
+	return out, nil
+}
+
+// rewrapHDWallets seals the key of every wallet derived from seed under
+// passphrase, re-deriving it from the seed. After recovery the seed and all
+// its wallets open with the same passphrase, whatever protected them before.
+func rewrapHDWallets(ctx context.Context, q pgx.Tx, userID string, seed []byte, passphrase string) error {
+	rows, err := q.Query(ctx,
+		`SELECT wallet_id, hd_index FROM wallets WHERE user_id=$1 AND hd_index IS NOT NULL`, userID)
+	if err != nil {
+		return err
+	}
+	indexes := map[string]int{}
+	for rows.Next() {
+		var id string
+		var index int
+		if err := rows.Scan(&id, &index); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes[id] = index
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, index := range indexes {
+		priv, err := hd.WalletKey(seed, uint32(index))
+		if err != nil {
+			return err
+		}
+		if crypto.WalletHashFromPublicKeyHex(crypto.SerializePublicKey(&priv.PublicKey)) != id {
+			return fmt.Errorf("wallet %s is not index %d of this seed", id, index)
+		}
+		encPriv, err := envelope.Seal(crypto.PrivateKeyBytes(priv), passphrase)
+		if err != nil {
+			return err
+		}
+		if _, err := q.Exec(ctx, `UPDATE wallets SET private_key_enc=$2 WHERE wallet_id=$1`, id, encPriv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
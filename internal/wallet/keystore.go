@@ -0,0 +1,234 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/audit"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/keystore"
+)
+
+type ExportRequest struct {
+	WalletID         string `json:"wallet_id"`
+	Passphrase       string `json:"passphrase"`        // wallet passphrase, if the key is passphrase-wrapped
+	ExportPassphrase string `json:"export_passphrase"` // encrypts the keystore file
+	KDF              string `json:"kdf"`               // scrypt (default) or argon2id
+}
+
+type ImportRequest struct {
+	Keystore           keystore.File `json:"keystore"`
+	KeystorePassphrase string        `json:"keystore_passphrase"`
+	Passphrase         string        `json:"passphrase"` // optional; protects the imported key on the server
+}
+
+// ✅ Export a custodial wallet's key as a passphrase-encrypted keystore file
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WalletID == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := address.Normalize(&req.WalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	ev := audit.Event{Action: "wallet.export", UserID: userID, WalletID: req.WalletID, RemoteIP: audit.RemoteIP(r)}
+	deny := func(status int, reason string) {
+		ev.Outcome, ev.Reason = audit.Denied, reason
+		if status >= 500 {
+			ev.Outcome = audit.Failed
+		}
+		if err := audit.Record(ctx, ev); err != nil {
+			log.Printf("audit: %v", err)
+		}
+		http.Error(w, reason, status)
+	}
+
+	if len(req.ExportPassphrase) < envelope.MinPassphraseLen {
+		deny(http.StatusBadRequest, "export "+envelope.ErrPassphrase.Error())
+		return
+	}
+	kdf := keystore.DefaultScrypt()
+	switch req.KDF {
+	case "", "scrypt":
+	case "argon2id":
+		kdf = keystore.DefaultArgon2id()
+	default:
+		deny(http.StatusBadRequest, "kdf must be scrypt or argon2id")
+		return
+	}
+
+	var owner, pubHex, keyType string
+	var encPriv *string
+	err := dbPool.QueryRow(ctx,
+		`SELECT user_id, public_key, key_type, private_key_enc FROM wallets WHERE wallet_id=$1`, req.WalletID).
+		Scan(&owner, &pubHex, &keyType, &encPriv)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && owner != userID) {
+		deny(http.StatusNotFound, "wallet not found")
+		return
+	}
+	if err != nil {
+		deny(http.StatusInternalServerError, "db error")
+		return
+	}
+	if encPriv == nil {
+		deny(http.StatusConflict, "wallet key is held by the client")
+		return
+	}
+
+	d, err := envelope.Open(*encPriv, req.Passphrase)
+	switch {
+	case errors.Is(err, envelope.ErrWrongPassphrase):
+		deny(http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, envelope.ErrNotEnvelope):
+		deny(http.StatusConflict, "wallet key must be migrated with rekey first")
+		return
+	case err != nil:
+		log.Printf("export %s: %v", req.WalletID, err)
+		deny(http.StatusInternalServerError, "decryption error")
+		return
+	}
+	kt, err := crypto.LookupKeyType(keyType)
+	if err != nil {
+		deny(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if priv, err := kt.PrivateKeyFromBytes(d); err != nil || priv.Public().Hex() != pubHex {
+		deny(http.StatusInternalServerError, "stored key does not match wallet")
+		return
+	}
+
+	file, err := keystore.Seal(d, pubHex, keyType, req.ExportPassphrase, kdf)
+	if err != nil {
+		deny(http.StatusInternalServerError, "encryption error")
+		return
+	}
+
+	// ✅ No audit record, no export
+	ev.Outcome, ev.Details = audit.Success, map[string]any{"kdf": kdf.Name}
+	if err := audit.Record(ctx, ev); err != nil {
+		log.Printf("audit: %v", err)
+		http.Error(w, "audit error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+req.WalletID+`.json"`)
+	json.NewEncoder(w).Encode(file)
+}
+
+// ✅ Create a custodial wallet from a keystore file
+func ImportHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.KeystorePassphrase == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	kt, err := crypto.LookupKeyType(req.Keystore.KeyType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := req.Keystore.Open(req.KeystorePassphrase)
+	switch {
+	case errors.Is(err, keystore.ErrWrongPassphrase):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	priv, err := kt.PrivateKeyFromBytes(d)
+	if err != nil {
+		http.Error(w, "invalid private key", http.StatusBadRequest)
+		return
+	}
+	pubHex := priv.Public().Hex()
+	if req.Keystore.PublicKey != "" && req.Keystore.PublicKey != pubHex {
+		http.Error(w, "keystore public key does not match its private key", http.StatusBadRequest)
+		return
+	}
+	if req.Keystore.WalletID != "" && req.Keystore.WalletID != crypto.WalletHashFromPublicKeyHex(pubHex) {
+		http.Error(w, "keystore wallet_id does not match its private key", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+
+	var exists bool
+	if err := dbTx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM wallets WHERE wallet_id=$1)`,
+		crypto.WalletHashFromPublicKeyHex(pubHex)).Scan(&exists); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "wallet already registered", http.StatusConflict)
+		return
+	}
+	walletID, _, err := insertWallet(ctx, dbTx, userID, priv, req.Passphrase, nil)
+	if errors.Is(err, envelope.ErrPassphrase) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("import: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit.Record(ctx, audit.Event{
+		Action: "wallet.import", Outcome: audit.Success, UserID: userID, WalletID: walletID, RemoteIP: audit.RemoteIP(r),
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+
+	protection := envelope.WrapMaster
+	if req.Passphrase != "" {
+		protection = envelope.WrapPassphrase
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"wallet_id":      walletID,
+		"address":        address.For(walletID),
+		"public_key":     pubHex,
+		"key_type":       kt.Name(),
+		"key_protection": protection,
+	})
+}
@@ -0,0 +1,154 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+)
+
+const (
+	maxLabelLen = 64
+	maxTags     = 16
+)
+
+var ErrNoDefaultWallet = errors.New("no default wallet set")
+
+// MetaRequest updates only the fields that are present.
+type MetaRequest struct {
+	WalletID string    `json:"wallet_id"`
+	Label    *string   `json:"label"`
+	Tags     *[]string `json:"tags"`
+	Default  *bool     `json:"default"`
+}
+
+// normalizeTags trims, lower-cases and de-duplicates tags.
+func normalizeTags(in []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range in {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if len(t) > maxLabelLen {
+			return nil, errors.New("tag too long")
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) > maxTags {
+		return nil, errors.New("too many tags")
+	}
+	return out, nil
+}
+
+// ✅ Set a wallet's label, tags or default flag
+func MetaHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req MetaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WalletID == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := address.Normalize(&req.WalletID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := EnsureWalletOwnedByUser(dbPool, req.WalletID, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+
+	if req.Label != nil {
+		label := strings.TrimSpace(*req.Label)
+		if len(label) > maxLabelLen {
+			http.Error(w, "label too long", http.StatusBadRequest)
+			return
+		}
+		if _, err := dbTx.Exec(ctx, `UPDATE wallets SET label=$2 WHERE wallet_id=$1`, req.WalletID, label); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := dbTx.Exec(ctx, `UPDATE wallets SET tags=$2 WHERE wallet_id=$1`, req.WalletID, tags); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.Default != nil {
+		// Clear the old default first so the one-default index is never violated
+		if *req.Default {
+			if _, err := dbTx.Exec(ctx,
+				`UPDATE wallets SET is_default=false WHERE user_id=$1 AND is_default`, userID); err != nil {
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if _, err := dbTx.Exec(ctx,
+			`UPDATE wallets SET is_default=$2 WHERE wallet_id=$1`, req.WalletID, *req.Default); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var label string
+	var tags []string
+	var isDefault bool
+	if err := dbTx.QueryRow(ctx,
+		`SELECT label, tags, is_default FROM wallets WHERE wallet_id=$1`, req.WalletID).
+		Scan(&label, &tags, &isDefault); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"wallet_id":  req.WalletID,
+		"address":    address.For(req.WalletID),
+		"label":      label,
+		"tags":       tags,
+		"is_default": isDefault,
+	})
+}
+
+// DefaultWallet returns the user's default wallet.
+func DefaultWallet(ctx context.Context, userID string) (string, error) {
+	var walletID string
+	err := dbPool.QueryRow(ctx,
+		`SELECT wallet_id FROM wallets WHERE user_id=$1 AND is_default`, userID).Scan(&walletID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNoDefaultWallet
+	}
+	return walletID, err
+}
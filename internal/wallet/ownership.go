@@ -7,15 +7,48 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrWalletNotFound = errors.New("wallet not found")
+	ErrNotReadable    = errors.New("forbidden")
+	ErrWatchOnly      = errors.New("forbidden: wallet is watch-only")
+)
+
 func EnsureWalletOwnedByUser(pool *pgxpool.Pool, walletID string, userID string) error {
 	var owner string
+	var watched bool
 	err := pool.QueryRow(context.Background(),
-		`SELECT user_id FROM wallets WHERE wallet_id=$1`, walletID).Scan(&owner)
+		`SELECT user_id,
+                EXISTS (SELECT 1 FROM watched_wallets WHERE wallet_id=$1 AND user_id=$2)
+         FROM wallets WHERE wallet_id=$1`, walletID, userID).Scan(&owner, &watched)
 	if err != nil {
-		return errors.New("wallet not found")
+		return ErrWalletNotFound
 	}
 	if owner != userID {
+		if watched {
+			return ErrWatchOnly
+		}
 		return errors.New("forbidden: wallet ownership mismatch")
 	}
 	return nil
 }
+
+// EnsureWalletReadableByUser allows owners and watchers. It reports whether
+// the user only watches the wallet.
+func EnsureWalletReadableByUser(pool *pgxpool.Pool, walletID string, userID string) (bool, error) {
+	var owner string
+	var watched bool
+	err := pool.QueryRow(context.Background(),
+		`SELECT user_id,
+                EXISTS (SELECT 1 FROM watched_wallets WHERE wallet_id=$1 AND user_id=$2)
+         FROM wallets WHERE wallet_id=$1`, walletID, userID).Scan(&owner, &watched)
+	if err != nil {
+		return false, ErrWalletNotFound
+	}
+	if owner == userID {
+		return false, nil
+	}
+	if watched {
+		return true, nil
+	}
+	return false, ErrNotReadable
+}
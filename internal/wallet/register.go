@@ -0,0 +1,207 @@
+package wallet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+)
+
+// challengeTTL is how long a registration challenge can be answered.
+const challengeTTL = 5 * time.Minute
+
+// RegisterPayload is what the client signs to prove it holds the private key.
+// The "register|" prefix keeps it distinct from any transaction payload.
+func RegisterPayload(publicKey, challenge string) string {
+	return "register|public_key=" + publicKey + "|challenge=" + challenge
+}
+
+type ChallengeRequest struct {
+	PublicKey string `json:"public_key"` // hex: uncompressed point for ECDSA keys, 32 bytes for Ed25519
+	KeyType   string `json:"key_type"`   // optional: ECDSA_P256 (default), ECDSA_SECP256K1 or ED25519
+}
+
+type RegisterRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	PublicKey   string `json:"public_key"`
+	SignatureR  string `json:"signature_r"` // signature over RegisterPayload
+	SignatureS  string `json:"signature_s"`
+	Signature   string `json:"signature"` // optional instead of r/s: hex of 64-byte compact r||s, or DER for ECDSA
+}
+
+// ✅ Issue a challenge for registering a client-held public key
+func RegisterChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req ChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PublicKey == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	kt, err := crypto.LookupKeyType(req.KeyType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pub, err := kt.ParsePublicKey(req.PublicKey)
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	// One key, one wallet ID: hashed and signed in its canonical encoding only
+	req.PublicKey = pub.Hex()
+	walletID := crypto.WalletHashFromPublicKeyHex(req.PublicKey)
+
+	ctx := context.Background()
+	var exists bool
+	if err := dbPool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM wallets WHERE wallet_id=$1)`, walletID).Scan(&exists); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "wallet already registered", http.StatusConflict)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "challenge error", http.StatusInternalServerError)
+		return
+	}
+	challenge := hex.EncodeToString(b)
+	expiresAt := time.Now().Add(challengeTTL).UTC().Truncate(time.Second)
+
+	var challengeID string
+	if err := dbPool.QueryRow(ctx,
+		`INSERT INTO wallet_challenges (user_id, public_key, key_type, challenge, expires_at)
+         VALUES ($1,$2,$3,$4,$5) RETURNING challenge_id::text`,
+		userID, req.PublicKey, kt.Name(), challenge, expiresAt).Scan(&challengeID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"challenge_id": challengeID,
+		"challenge":    challenge,
+		"wallet_id":    walletID,
+		"address":      address.For(walletID),
+		"key_type":     kt.Name(),
+		"payload":      RegisterPayload(req.PublicKey, challenge),
+		"expires_at":   expiresAt,
+	})
+}
+
+// ✅ Register a wallet whose private key stays with the client
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeID == "" || req.PublicKey == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer dbTx.Rollback(ctx)
+
+	var owner, publicKey, keyType, challenge string
+	var expiresAt time.Time
+	var usedAt *time.Time
+	err = dbTx.QueryRow(ctx,
+		`SELECT user_id::text, public_key, key_type, challenge, expires_at, used_at
+         FROM wallet_challenges WHERE challenge_id=$1::uuid FOR UPDATE`, req.ChallengeID).
+		Scan(&owner, &publicKey, &keyType, &challenge, &expiresAt, &usedAt)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && owner != userID) {
+		http.Error(w, "challenge not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if usedAt != nil || time.Now().After(expiresAt) {
+		http.Error(w, "challenge expired or already used", http.StatusGone)
+		return
+	}
+
+	// The challenge fixes the key type the signature is checked under
+	pub, err := crypto.ParsePublicKey(keyType, publicKey)
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	if sent, err := crypto.ParsePublicKey(keyType, req.PublicKey); err != nil || sent.Hex() != pub.Hex() {
+		http.Error(w, "challenge not found", http.StatusNotFound)
+		return
+	}
+	sigR, sigS, err := pub.ParseSignature(req.Signature, req.SignatureR, req.SignatureS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !pub.Verify([]byte(RegisterPayload(publicKey, challenge)), sigR, sigS) {
+		http.Error(w, "invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := dbTx.Exec(ctx,
+		`UPDATE wallet_challenges SET used_at=NOW() WHERE challenge_id=$1::uuid`, req.ChallengeID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	// ✅ No private_key_enc: the server never sees this key
+	walletID := crypto.WalletHashFromPublicKeyHex(pub.Hex())
+	tag, err := dbTx.Exec(ctx,
+		`INSERT INTO wallets (wallet_id, user_id, public_key, private_key_enc, key_type, wallet_hash, created_at)
+         VALUES ($1,$2,$3,NULL,$4,$5,$6)
+         ON CONFLICT (wallet_id) DO NOTHING`,
+		walletID, userID, pub.Hex(), pub.KeyType(), walletID, time.Now())
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "wallet already registered", http.StatusConflict)
+		return
+	}
+	if err := dbTx.Commit(ctx); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"wallet_id":  walletID,
+		"address":    address.For(walletID),
+		"public_key": publicKey,
+		"key_type":   pub.KeyType(),
+		"custody":    "client",
+	})
+}
@@ -0,0 +1,213 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/envelope"
+)
+
+var (
+	ErrSuccessorMismatch = errors.New("rotation already started with a different successor")
+	ErrInvalidSuccessor  = errors.New("successor must be another active wallet of the same user")
+	ErrNoSuccessor       = errors.New("successor_wallet_id or successor_key required: preview the rotation first")
+	ErrStaleSuccessor    = errors.New("the planned successor is no longer the seed's next wallet: preview the rotation again")
+)
+
+// maxSuccessorHops bounds how far a successor chain is followed.
+const maxSuccessorHops = 16
+
+// Successor reports whether walletID is retired and, if so, the active wallet
+// at the end of its successor chain.
+func Successor(ctx context.Context, walletID string) (bool, string, error) {
+	var retired bool
+	var next *string
+	if err := dbPool.QueryRow(ctx,
+		`SELECT retired_at IS NOT NULL, successor_wallet_id FROM wallets WHERE wallet_id=$1`, walletID).
+		Scan(&retired, &next); err != nil {
+		return false, "", err
+	}
+	if !retired || next == nil {
+		return false, "", nil
+	}
+	current := *next
+	for range maxSuccessorHops {
+		var r bool
+		var n *string
+		if err := dbPool.QueryRow(ctx,
+			`SELECT retired_at IS NOT NULL, successor_wallet_id FROM wallets WHERE wallet_id=$1`, current).
+			Scan(&r, &n); err != nil {
+			return true, current, err
+		}
+		if !r || n == nil {
+			break
+		}
+		current = *n
+	}
+	return true, current, nil
+}
+
+// Rotation is the successor chosen for a wallet being rotated.
+type Rotation struct {
+	SuccessorID  string
+	Created      bool   // the successor is a new wallet
+	SuccessorKey string // a new successor's sealed key, handed back to CommitRotation
+}
+
+// PlanRotation picks the successor of walletID without recording anything:
+// the successor on file, successorID, or a new wallet of the same key type
+// (derived from the user's seed when they have one). A new wallet exists only
+// as its sealed key in SuccessorKey until CommitRotation creates it, so the
+// sweep can be signed to it before anything changes.
+func PlanRotation(ctx context.Context, walletID, userID, successorID, passphrase string) (*Rotation, error) {
+	// Everything is worked out in a transaction that is never committed
+	dbTx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback(ctx)
+
+	keyType, onFile, err := lockRotating(ctx, dbTx, walletID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if onFile != nil {
+		if successorID != "" && successorID != *onFile {
+			return nil, ErrSuccessorMismatch
+		}
+		return &Rotation{SuccessorID: *onFile}, nil
+	}
+	if successorID != "" {
+		return &Rotation{SuccessorID: successorID}, checkSuccessor(ctx, dbTx, walletID, userID, successorID)
+	}
+
+	// The new key is of the same type as the one it replaces
+	kt, err := crypto.LookupKeyType(keyType)
+	if err != nil {
+		return nil, err
+	}
+	rot := &Rotation{Created: true}
+	if rot.SuccessorID, _, _, err = newWallet(ctx, dbTx, userID, kt, passphrase); err != nil {
+		return nil, err
+	}
+	err = dbTx.QueryRow(ctx,
+		`SELECT private_key_enc FROM wallets WHERE wallet_id=$1`, rot.SuccessorID).Scan(&rot.SuccessorKey)
+	return rot, err
+}
+
+// CommitRotation records the successor of walletID in the caller's
+// transaction: the one on file, a new wallet from the successorKey of
+// PlanRotation, or the existing wallet successorID. Preparing again returns
+// the successor already on file, so a retired wallet can be rotated again to
+// sweep funds that arrived later.
+func CommitRotation(ctx context.Context, q pgx.Tx, walletID, userID, successorID, successorKey, passphrase string) (*Rotation, error) {
+	keyType, onFile, err := lockRotating(ctx, q, walletID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if onFile != nil {
+		if successorID != "" && successorID != *onFile {
+			return nil, ErrSuccessorMismatch
+		}
+		return &Rotation{SuccessorID: *onFile}, nil
+	}
+
+	rot := &Rotation{SuccessorID: successorID}
+	switch {
+	case successorKey != "":
+		id, err := createSuccessor(ctx, q, userID, keyType, successorKey, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		if successorID != "" && successorID != id {
+			return nil, ErrInvalidSuccessor
+		}
+		rot.SuccessorID, rot.Created = id, true
+	case successorID == "":
+		return nil, ErrNoSuccessor
+	default:
+		if err := checkSuccessor(ctx, q, walletID, userID, successorID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := q.Exec(ctx,
+		`UPDATE wallets SET successor_wallet_id=$2 WHERE wallet_id=$1`, walletID, rot.SuccessorID); err != nil {
+		return nil, err
+	}
+	return rot, nil
+}
+
+// lockRotating locks walletID, which must belong to userID, and returns its
+// key type and recorded successor.
+func lockRotating(ctx context.Context, q pgx.Tx, walletID, userID string) (string, *string, error) {
+	var owner, keyType string
+	var onFile *string
+	err := q.QueryRow(ctx,
+		`SELECT user_id, key_type, successor_wallet_id FROM wallets WHERE wallet_id=$1 FOR UPDATE`, walletID).
+		Scan(&owner, &keyType, &onFile)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && owner != userID) {
+		return "", nil, errors.New("wallet not found")
+	}
+	return keyType, onFile, err
+}
+
+func checkSuccessor(ctx context.Context, q pgx.Tx, walletID, userID, successorID string) error {
+	var ok bool
+	if err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM wallets WHERE wallet_id=$1 AND user_id=$2 AND retired_at IS NULL)`,
+		successorID, userID).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok || successorID == walletID {
+		return ErrInvalidSuccessor
+	}
+	return nil
+}
+
+// createSuccessor stores the wallet planned by PlanRotation. A key that
+// PlanRotation derived from the user's seed must still be the seed's next
+// child, and takes that index.
+func createSuccessor(ctx context.Context, q pgx.Tx, userID, keyType, successorKey, passphrase string) (string, error) {
+	kt, err := crypto.LookupKeyType(keyType)
+	if err != nil {
+		return "", err
+	}
+	d, err := envelope.Open(successorKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer clear(d)
+	priv, err := kt.PrivateKeyFromBytes(d)
+	if err != nil {
+		return "", ErrInvalidSuccessor
+	}
+
+	var hdIndex *int
+	if kt.Name() == crypto.KeyTypeP256 {
+		hdKey, index, err := nextHDKey(ctx, q, userID, passphrase)
+		switch {
+		case errors.Is(err, errNoSeed):
+		case err != nil:
+			return "", err
+		case crypto.SerializePublicKey(&hdKey.PublicKey) != priv.Public().Hex():
+			return "", ErrStaleSuccessor
+		default:
+			hdIndex = &index
+		}
+	}
+	walletID, _, err := insertWallet(ctx, q, userID, priv, passphrase, hdIndex)
+	return walletID, err
+}
+
+// Retire marks walletID retired in favour of its recorded successor, in the
+// caller's transaction. Retiring an already retired wallet is a no-op.
+func Retire(ctx context.Context, q pgx.Tx, walletID, successorID string) error {
+	_, err := q.Exec(ctx,
+		`UPDATE wallets SET retired_at=NOW()
+         WHERE wallet_id=$1 AND successor_wallet_id=$2 AND retired_at IS NULL`, walletID, successorID)
+	return err
+}
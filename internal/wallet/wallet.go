@@ -3,9 +3,12 @@ package wallet
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
 	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
 )
 
@@ -18,8 +21,21 @@ func ListHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := claims["user_id"].(string)
 
+	// Optional ?tag= filter; the default wallet is listed first, watched wallets last
+	var tag any
+	if t := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag"))); t != "" {
+		tag = t
+	}
 	rows, err := dbPool.Query(context.Background(),
-		`SELECT wallet_id, public_key, created_at FROM wallets WHERE user_id=$1`, userID)
+		`SELECT wallet_id, public_key, key_type, label, tags, is_default, retired_at IS NOT NULL, false, created_at
+         FROM wallets
+         WHERE user_id=$1 AND ($2::text IS NULL OR $2 = ANY(tags))
+         UNION ALL
+         SELECT w.wallet_id, w.public_key, w.key_type, ww.label, '{}'::text[], false, w.retired_at IS NOT NULL, true, w.created_at
+         FROM watched_wallets ww
+         JOIN wallets w ON w.wallet_id = ww.wallet_id
+         WHERE ww.user_id=$1 AND $2::text IS NULL
+         ORDER BY 6 DESC, 8, 9`, userID, tag)
 	if err != nil {
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
@@ -28,16 +44,25 @@ func ListHandler(w http.ResponseWriter, r *http.Request) {
 
 	type W struct {
 		WalletID  string    `json:"wallet_id"`
+		Address   string    `json:"address"`
 		PublicKey string    `json:"public_key"`
+		KeyType   string    `json:"key_type"`
+		Label     string    `json:"label"`
+		Tags      []string  `json:"tags"`
+		IsDefault bool      `json:"is_default"`
+		Retired   bool      `json:"retired"`
+		WatchOnly bool      `json:"watch_only"`
 		CreatedAt time.Time `json:"created_at"`
 	}
 	var list []W
 	for rows.Next() {
 		var wallet W
-		if err := rows.Scan(&wallet.WalletID, &wallet.PublicKey, &wallet.CreatedAt); err != nil {
+		if err := rows.Scan(&wallet.WalletID, &wallet.PublicKey, &wallet.KeyType, &wallet.Label, &wallet.Tags,
+			&wallet.IsDefault, &wallet.Retired, &wallet.WatchOnly, &wallet.CreatedAt); err != nil {
 			http.Error(w, "scan error", http.StatusInternalServerError)
 			return
 		}
+		wallet.Address = address.For(wallet.WalletID)
 		list = append(list, wallet)
 	}
 
@@ -54,31 +79,69 @@ func DetailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := claims["user_id"].(string)
 
-	walletID := r.URL.Query().Get("wallet_id")
+	walletID, err := address.FromQuery(r, "wallet_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if walletID == "" {
 		http.Error(w, "wallet_id required", http.StatusBadRequest)
 		return
 	}
 
-	var pubKey, owner string
+	var pubKey, keyType, owner string
 	var created time.Time
-	err := dbPool.QueryRow(context.Background(),
-		`SELECT user_id, public_key, created_at FROM wallets WHERE wallet_id=$1`, walletID).
-		Scan(&owner, &pubKey, &created)
+	var retiredAt *time.Time
+	var successor *string
+	var label string
+	var tags []string
+	var isDefault bool
+	var watchLabel *string
+	err = dbPool.QueryRow(context.Background(),
+		`SELECT w.user_id, w.public_key, w.key_type, w.created_at, w.retired_at, w.successor_wallet_id, w.label, w.tags, w.is_default, ww.label
+         FROM wallets w
+         LEFT JOIN watched_wallets ww ON ww.wallet_id = w.wallet_id AND ww.user_id = $2
+         WHERE w.wallet_id=$1`, walletID, userID).
+		Scan(&owner, &pubKey, &keyType, &created, &retiredAt, &successor, &label, &tags, &isDefault, &watchLabel)
 	if err != nil {
 		http.Error(w, "wallet not found", http.StatusNotFound)
 		return
 	}
-	if owner != userID {
+	watchOnly := owner != userID
+	if watchOnly && watchLabel == nil {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
+	// The owner's label and tags are theirs; watchers see their own label
+	if watchOnly {
+		label, tags, isDefault = *watchLabel, []string{}, false
+	}
+	var successorAddr *string
+	if successor != nil {
+		a := address.For(*successor)
+		successorAddr = &a
+	}
+	balance, err := WalletBalance(context.Background(), dbPool, walletID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"wallet_id":  walletID,
-		"public_key": pubKey,
-		"created_at": created,
+		"wallet_id":           walletID,
+		"address":             address.For(walletID),
+		"public_key":          pubKey,
+		"key_type":            keyType,
+		"label":               label,
+		"tags":                tags,
+		"is_default":          isDefault,
+		"watch_only":          watchOnly,
+		"balance":             balance,
+		"created_at":          created,
+		"retired_at":          retiredAt,
+		"successor_wallet_id": successor,
+		"successor_address":   successorAddr,
 	})
 }
 
@@ -91,22 +154,24 @@ func UtxosHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := claims["user_id"].(string)
 
-	walletID := r.URL.Query().Get("wallet_id")
+	walletID, err := address.FromQuery(r, "wallet_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if walletID == "" {
 		http.Error(w, "wallet_id required", http.StatusBadRequest)
 		return
 	}
 
-	// Ownership check
-	var owner string
-	err := dbPool.QueryRow(context.Background(),
-		`SELECT user_id FROM wallets WHERE wallet_id=$1`, walletID).Scan(&owner)
-	if err != nil {
-		http.Error(w, "wallet not found", http.StatusNotFound)
+	// Owners and watchers may read
+	watchOnly, err := EnsureWalletReadableByUser(dbPool, walletID, userID)
+	if errors.Is(err, ErrWalletNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	if owner != userID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
@@ -135,8 +200,10 @@ func UtxosHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"wallet_id": walletID,
-		"utxos":     list,
+		"wallet_id":  walletID,
+		"address":    address.For(walletID),
+		"watch_only": watchOnly,
+		"utxos":      list,
 	})
 }
 
@@ -149,30 +216,34 @@ func TxHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := claims["user_id"].(string)
 
-	walletID := r.URL.Query().Get("wallet_id")
+	walletID, err := address.FromQuery(r, "wallet_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if walletID == "" {
 		http.Error(w, "wallet_id required", http.StatusBadRequest)
 		return
 	}
 
-	// Ownership check
-	var owner string
-	err := dbPool.QueryRow(context.Background(),
-		`SELECT user_id FROM wallets WHERE wallet_id=$1`, walletID).Scan(&owner)
-	if err != nil {
-		http.Error(w, "wallet not found", http.StatusNotFound)
+	// Owners and watchers may read
+	watchOnly, err := EnsureWalletReadableByUser(dbPool, walletID, userID)
+	if errors.Is(err, ErrWalletNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	if owner != userID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
 	rows, err := dbPool.Query(context.Background(),
-		`SELECT tx_id::text, from_wallet_id, to_wallet_id, amount, fee, status, created_at
-         FROM transactions
-         WHERE from_wallet_id=$1 OR to_wallet_id=$1
-         ORDER BY created_at DESC`, walletID)
+		`SELECT t.tx_id::text, t.from_wallet_id, t.to_wallet_id, t.amount, t.fee, t.status, t.created_at,
+                COALESCE((SELECT MAX(height) FROM blocks) - b.height + 1, 0)
+         FROM transactions t
+         LEFT JOIN blocks b ON b.block_id = t.block_id
+         WHERE t.from_wallet_id=$1 OR t.to_wallet_id=$1
+         ORDER BY t.created_at DESC`, walletID)
 	if err != nil {
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
@@ -180,27 +251,49 @@ func TxHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type T struct {
-		TxID    string `json:"tx_id"`
-		From    string `json:"from_wallet_id"`
-		To      string `json:"to_wallet_id"`
-		Amount  int64  `json:"amount"`
-		Fee     int64  `json:"fee"`
-		Status  string `json:"status"`
-		Created string `json:"created_at"`
+		TxID     string `json:"tx_id"`
+		From     string `json:"from_wallet_id"`
+		To       string `json:"to_wallet_id"`
+		FromAddr string `json:"from_address"`
+		ToAddr   string `json:"to_address"`
+		Amount   int64  `json:"amount"`
+		Fee      int64  `json:"fee"`
+		Status   string `json:"status"`
+		Created  string `json:"created_at"`
+		Confirms int    `json:"confirmations"`
+
+		Counterparty string `json:"counterparty,omitempty"` // contact name or own wallet label
 	}
 	var list []T
 	for rows.Next() {
 		var t T
-		if err := rows.Scan(&t.TxID, &t.From, &t.To, &t.Amount, &t.Fee, &t.Status, &t.Created); err != nil {
+		if err := rows.Scan(&t.TxID, &t.From, &t.To, &t.Amount, &t.Fee, &t.Status, &t.Created, &t.Confirms); err != nil {
 			http.Error(w, "scan error", http.StatusInternalServerError)
 			return
 		}
 		list = append(list, t)
 	}
 
+	// Name the other side of each transaction from the address book
+	var others []string
+	for _, t := range list {
+		others = append(others, Counterparty(walletID, t.From, t.To))
+	}
+	names, err := CounterpartyNames(context.Background(), userID, others)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	for i, t := range list {
+		list[i].FromAddr, list[i].ToAddr = address.For(t.From), address.For(t.To)
+		list[i].Counterparty = names[Counterparty(walletID, t.From, t.To)]
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"wallet_id":    walletID,
+		"address":      address.For(walletID),
+		"watch_only":   watchOnly,
 		"transactions": list,
 	})
 }
@@ -0,0 +1,117 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/address"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/auth"
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/crypto"
+)
+
+type WatchRequest struct {
+	WalletID  string `json:"wallet_id"`
+	PublicKey string `json:"public_key"` // alternative to wallet_id
+	Label     string `json:"label"`
+}
+
+// ✅ Add (POST) or remove (DELETE ?wallet_id=) a watch-only wallet
+func WatchHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r)
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := claims["user_id"].(string)
+	ctx := context.Background()
+
+	switch r.Method {
+	case http.MethodPost:
+		var req WatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := address.Normalize(&req.WalletID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.PublicKey != "" {
+			// Any supported key type; the wallet lookup below decides the rest
+			canonical := ""
+			for _, name := range crypto.KeyTypes() {
+				if pub, err := crypto.ParsePublicKey(name, req.PublicKey); err == nil {
+					canonical = pub.Hex()
+				}
+			}
+			if canonical == "" {
+				http.Error(w, "invalid public key", http.StatusBadRequest)
+				return
+			}
+			// Wallet IDs hash the canonical encoding, whatever case was sent
+			id := crypto.WalletHashFromPublicKeyHex(canonical)
+			if req.WalletID != "" && req.WalletID != id {
+				http.Error(w, "wallet_id does not match public_key", http.StatusBadRequest)
+				return
+			}
+			req.WalletID = id
+		}
+		req.Label = strings.TrimSpace(req.Label)
+		if req.WalletID == "" {
+			http.Error(w, "wallet_id or public_key required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Label) > maxLabelLen {
+			http.Error(w, "label too long", http.StatusBadRequest)
+			return
+		}
+
+		var owner string
+		if err := dbPool.QueryRow(ctx,
+			`SELECT user_id FROM wallets WHERE wallet_id=$1`, req.WalletID).Scan(&owner); err != nil {
+			http.Error(w, ErrWalletNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		if owner == userID {
+			http.Error(w, "wallet is already yours", http.StatusConflict)
+			return
+		}
+		if _, err := dbPool.Exec(ctx,
+			`INSERT INTO watched_wallets (user_id, wallet_id, label) VALUES ($1,$2,$3)
+             ON CONFLICT (user_id, wallet_id) DO UPDATE SET label=$3`,
+			userID, req.WalletID, req.Label); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"wallet_id":  req.WalletID,
+			"address":    address.For(req.WalletID),
+			"label":      req.Label,
+			"watch_only": true,
+		})
+
+	case http.MethodDelete:
+		walletID, err := address.FromQuery(r, "wallet_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tag, err := dbPool.Exec(ctx,
+			`DELETE FROM watched_wallets WHERE user_id=$1 AND wallet_id=$2`, userID, walletID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			http.Error(w, "not watching this wallet", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
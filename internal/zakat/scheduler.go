@@ -2,13 +2,12 @@ package zakat
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Tallal-Arif/CryptoWalletBlockchainBackend/internal/tx"
 )
 
 var dbPool *pgxpool.Pool
@@ -60,17 +59,21 @@ func runZakatDeduction() {
 			continue
 		}
 
-		var txID string
-		err = dbPool.QueryRow(ctx,
-			`INSERT INTO transactions (from_wallet_id, to_wallet_id, amount, fee, nonce, note, timestamp, status)
-             VALUES ($1,$2,$3,0,$4,$5,NOW(),'pending')
-             RETURNING tx_id::text`,
-			wid, zakatWalletID, zakatAmt, fmt.Sprintf("zakat-%d", time.Now().Unix()), "zakat deduction").
-			Scan(&txID)
+		// System transfer: spends the wallet's real UTXOs so it survives commit validation
+		resp, err := tx.Submit(ctx, tx.Transfer{
+			FromWalletID: wid,
+			ToWalletID:   zakatWalletID,
+			Amount:       zakatAmt,
+			Nonce:        fmt.Sprintf("zakat-%d", time.Now().Unix()),
+			Timestamp:    time.Now().UTC().Format(time.RFC3339),
+			Note:         "zakat deduction",
+			Kind:         tx.KindSystem,
+		})
 		if err != nil {
 			fmt.Println("zakat insert tx error:", err)
 			continue
 		}
+		txID := resp.TxID
 		txIDs = append(txIDs, txID)
 
 		// Log event
@@ -85,61 +88,7 @@ func runZakatDeduction() {
 		fmt.Println("No zakat transactions created")
 		return
 	}
-
-	// Mine block immediately
-	mineBlock(ctx, txIDs)
-}
-
-func mineBlock(ctx context.Context, txIDs []string) {
-	var prevHash string
-	var latestHeight int
-	err := dbPool.QueryRow(ctx, `SELECT hash, height FROM blocks ORDER BY height DESC LIMIT 1`).Scan(&prevHash, &latestHeight)
-	if err != nil {
-		prevHash = "0"
-		latestHeight = -1
-	}
-
-	nextHeight := latestHeight + 1
-	timestamp := time.Now().UTC().Format(time.RFC3339)
-	joined := strings.Join(txIDs, ",")
-	nonce := int64(0)
-	difficulty := 5
-	target := strings.Repeat("0", difficulty)
-	var finalHash string
-
-	for {
-		header := fmt.Sprintf("%d|%s|%s|%s|%d", nextHeight, prevHash, timestamp, joined, nonce)
-		sum := sha256.Sum256([]byte(header))
-		hashHex := hex.EncodeToString(sum[:])
-		if strings.HasPrefix(hashHex, target) {
-			finalHash = hashHex
-			break
-		}
-		nonce++
-	}
-
-	var blockID string
-	err = dbPool.QueryRow(ctx,
-		`INSERT INTO blocks (height, prev_hash, hash, nonce, difficulty, created_at)
-         VALUES ($1,$2,$3,$4,$5,NOW())
-         RETURNING block_id::text`,
-		nextHeight, prevHash, finalHash, nonce, difficulty).Scan(&blockID)
-	if err != nil {
-		fmt.Println("zakat insert block error:", err)
-		return
-	}
-
-	_, err = dbPool.Exec(ctx,
-		`UPDATE transactions SET status='committed', block_id=$1 WHERE tx_id = ANY($2::uuid[])`,
-		blockID, txIDs)
-	if err != nil {
-		fmt.Println("zakat update tx error:", err)
-		return
-	}
-
-	_, _ = dbPool.Exec(ctx,
-		`INSERT INTO system_logs (id, type, message, metadata, timestamp)
-         VALUES (gen_random_uuid(),'block',$1,$2,NOW())`,
-		fmt.Sprintf("Zakat block mined at height %d", nextHeight),
-		fmt.Sprintf(`{"block_id":"%s","hash":"%s","tx_count":%d}`, blockID, finalHash, len(txIDs)))
+	// Zakat transfers wait in the mempool like any other and are mined by the
+	// block commit, which re-validates them.
+	fmt.Printf("%d zakat transactions pending\n", len(txIDs))
 }
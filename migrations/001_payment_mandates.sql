@@ -0,0 +1,31 @@
+-- Pre-authorized recurring payments executed by internal/schedule.
+CREATE TABLE IF NOT EXISTS payment_mandates (
+    mandate_id        uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id           uuid NOT NULL REFERENCES users(id),
+    from_wallet_id    text NOT NULL REFERENCES wallets(wallet_id),
+    to_wallet_id      text NOT NULL REFERENCES wallets(wallet_id),
+    amount            bigint NOT NULL CHECK (amount > 0),
+    fee               bigint NOT NULL DEFAULT 0,
+    note              text NOT NULL DEFAULT '',
+    interval          text NOT NULL CHECK (interval IN ('daily','weekly','monthly')),
+    start_at          timestamptz NOT NULL,
+    max_runs          integer NOT NULL DEFAULT 0,
+    runs              integer NOT NULL DEFAULT 0,
+    next_run_at       timestamptz NOT NULL,
+    retries           integer NOT NULL DEFAULT 0,
+    last_error        text,
+    last_tx_id        uuid,
+    status            text NOT NULL DEFAULT 'active'
+                      CHECK (status IN ('active','paused','cancelled','completed')),
+    sender_public_key text NOT NULL,
+    signature_r       text NOT NULL,
+    signature_s       text NOT NULL,
+    timestamp         text NOT NULL,
+    created_at        timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payment_mandates_due_idx
+    ON payment_mandates (next_run_at) WHERE status = 'active';
+
+-- Transactions executed from a mandate carry the mandate's signature.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS mandate_id uuid REFERENCES payment_mandates(mandate_id);
@@ -0,0 +1,25 @@
+-- Merchant payment requests handled by internal/invoice.
+CREATE TABLE IF NOT EXISTS invoices (
+    invoice_id  uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     uuid NOT NULL REFERENCES users(id),
+    wallet_id   text NOT NULL REFERENCES wallets(wallet_id),
+    amount      bigint NOT NULL CHECK (amount > 0),
+    amount_paid bigint NOT NULL DEFAULT 0,
+    memo        text NOT NULL DEFAULT '',
+    reference   text NOT NULL DEFAULT '',
+    status      text NOT NULL DEFAULT 'open'
+                CHECK (status IN ('open','partially_paid','paid','expired')),
+    expires_at  timestamptz NOT NULL,
+    paid_at     timestamptz,
+    created_at  timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invoices_user_idx ON invoices (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS invoice_payments (
+    invoice_id uuid NOT NULL REFERENCES invoices(invoice_id),
+    tx_id      uuid NOT NULL REFERENCES transactions(tx_id),
+    amount     bigint NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (invoice_id, tx_id)
+);
@@ -0,0 +1,7 @@
+-- Block commit re-validates pending transactions and records why one was dropped.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reject_reason text;
+
+-- 'transfer' rows are signed by the sender; 'system' rows (zakat) are created by
+-- the server and carry no signature, but must still spend real inputs.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS kind text NOT NULL DEFAULT 'transfer'
+    CHECK (kind IN ('transfer','system'));
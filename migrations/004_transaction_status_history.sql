@@ -0,0 +1,20 @@
+-- Lifecycle of a transaction: pending → committed → confirmed, or pending →
+-- rejected | expired | replaced. Every move is recorded here.
+CREATE TABLE IF NOT EXISTS transaction_status_history (
+    id          bigserial PRIMARY KEY,
+    tx_id       uuid NOT NULL REFERENCES transactions(tx_id),
+    from_status text,
+    to_status   text NOT NULL,
+    reason      text,
+    block_id    uuid,
+    changed_at  timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS transaction_status_history_tx_idx
+    ON transaction_status_history (tx_id, changed_at);
+
+-- Seed history with the current status of existing rows.
+INSERT INTO transaction_status_history (tx_id, from_status, to_status, reason, block_id, changed_at)
+SELECT t.tx_id, NULL, t.status, 'backfill', t.block_id, t.created_at
+FROM transactions t
+WHERE NOT EXISTS (SELECT 1 FROM transaction_status_history h WHERE h.tx_id = t.tx_id);
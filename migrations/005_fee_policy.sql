@@ -0,0 +1,9 @@
+-- Runtime-configurable fee policy (single row) and per-wallet fee tiers.
+CREATE TABLE IF NOT EXISTS fee_policy (
+    id         integer PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    policy     jsonb NOT NULL,
+    updated_by text,
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS tier text NOT NULL DEFAULT 'standard';
@@ -0,0 +1,3 @@
+-- Signatures that could not be normalized to fixed-width low-S by cmd/sigmigrate.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS signature_invalid boolean NOT NULL DEFAULT false;
+ALTER TABLE payment_mandates ADD COLUMN IF NOT EXISTS signature_invalid boolean NOT NULL DEFAULT false;
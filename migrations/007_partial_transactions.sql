@@ -0,0 +1,11 @@
+-- Partially signed transactions collected by internal/pst until finalized.
+CREATE TABLE IF NOT EXISTS partial_transactions (
+    pst_id         text PRIMARY KEY, -- hash of the unsigned packet
+    user_id        uuid NOT NULL REFERENCES users(id),
+    from_wallet_id text NOT NULL REFERENCES wallets(wallet_id),
+    packet         jsonb NOT NULL,
+    status         text NOT NULL DEFAULT 'open' CHECK (status IN ('open','finalized')),
+    tx_id          uuid REFERENCES transactions(tx_id),
+    created_at     timestamptz NOT NULL DEFAULT NOW(),
+    updated_at     timestamptz NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,13 @@
+-- Client-held keys: registered wallets have no server-side private key.
+ALTER TABLE wallets ALTER COLUMN private_key_enc DROP NOT NULL;
+
+-- Proof-of-possession challenges for /wallet/register.
+CREATE TABLE IF NOT EXISTS wallet_challenges (
+    challenge_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      uuid NOT NULL REFERENCES users(id),
+    public_key   text NOT NULL,
+    challenge    text NOT NULL,
+    expires_at   timestamptz NOT NULL,
+    used_at      timestamptz,
+    created_at   timestamptz NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,12 @@
+-- Mnemonic-backed HD seeds; wallets derived from a seed record their index.
+CREATE TABLE IF NOT EXISTS user_seeds (
+    user_id     uuid PRIMARY KEY REFERENCES users(id),
+    seed_enc    text NOT NULL, -- envelope, see internal/envelope
+    fingerprint text NOT NULL, -- identifies the seed without revealing it
+    next_index  integer NOT NULL DEFAULT 0,
+    created_at  timestamptz NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS hd_index integer;
+CREATE UNIQUE INDEX IF NOT EXISTS wallets_user_hd_index_idx
+    ON wallets (user_id, hd_index) WHERE hd_index IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Key rotation: a wallet names its successor when rotation starts and is
+-- retired once its funds have been swept there.
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS successor_wallet_id text REFERENCES wallets(wallet_id);
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS retired_at timestamptz;
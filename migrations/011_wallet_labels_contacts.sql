@@ -0,0 +1,16 @@
+-- User-facing wallet metadata; at most one default wallet per user.
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS label text NOT NULL DEFAULT '';
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS is_default boolean NOT NULL DEFAULT false;
+CREATE UNIQUE INDEX IF NOT EXISTS wallets_user_default_idx ON wallets (user_id) WHERE is_default;
+
+-- Address book of named counterparties.
+CREATE TABLE IF NOT EXISTS contacts (
+    contact_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL REFERENCES users(id),
+    name       text NOT NULL,
+    wallet_id  text NOT NULL,
+    note       text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS contacts_user_name_idx ON contacts (user_id, lower(name));
@@ -0,0 +1,8 @@
+-- Watch-only wallets: read access to balances and history, no spending.
+CREATE TABLE IF NOT EXISTS watched_wallets (
+    user_id    uuid NOT NULL REFERENCES users(id),
+    wallet_id  text NOT NULL REFERENCES wallets(wallet_id),
+    label      text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, wallet_id)
+);
@@ -0,0 +1,13 @@
+-- Spending policies enforced by /tx/send. Zero caps mean no limit; an empty
+-- allowlist allows any recipient; a NULL window allows any time of day.
+CREATE TABLE IF NOT EXISTS wallet_policies (
+    wallet_id     text PRIMARY KEY REFERENCES wallets(wallet_id),
+    per_tx_max    bigint NOT NULL DEFAULT 0,
+    daily_cap     bigint NOT NULL DEFAULT 0,
+    monthly_cap   bigint NOT NULL DEFAULT 0,
+    allowlist     text[] NOT NULL DEFAULT '{}',
+    window_start  text,          -- HH:MM, inclusive
+    window_end    text,          -- HH:MM, exclusive; may wrap past midnight
+    timezone      text NOT NULL DEFAULT 'UTC',
+    updated_at    timestamptz NOT NULL DEFAULT NOW()
+);
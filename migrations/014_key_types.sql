@@ -0,0 +1,8 @@
+-- Wallet keys may be P-256, secp256k1 or Ed25519; see internal/crypto.
+UPDATE wallets SET key_type = 'ECDSA_P256' WHERE key_type IS NULL OR key_type = '';
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_key_type_check;
+ALTER TABLE wallets ADD CONSTRAINT wallets_key_type_check
+    CHECK (key_type IN ('ECDSA_P256', 'ECDSA_SECP256K1', 'ED25519'));
+
+-- A registration challenge is answered with a key of the type it was issued for.
+ALTER TABLE wallet_challenges ADD COLUMN IF NOT EXISTS key_type text NOT NULL DEFAULT 'ECDSA_P256';
@@ -0,0 +1,13 @@
+-- Re-authentication codes from /auth/reauth, one per user and purpose, kept
+-- apart from the login OTP in users.otp_code. Only a hash of the code is
+-- stored. Failed attempts count across reissues and lock the purpose for a
+-- while once they reach the limit.
+CREATE TABLE IF NOT EXISTS reauth_codes (
+    user_id       uuid NOT NULL REFERENCES users(id),
+    purpose       text NOT NULL,
+    code_hash     text,
+    expires_at    timestamptz,
+    attempts      int NOT NULL DEFAULT 0,
+    locked_until  timestamptz,
+    PRIMARY KEY (user_id, purpose)
+);